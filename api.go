@@ -7,13 +7,24 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"reflect"
+	"sort"
 	"sync"
-	"time"
+	"sync/atomic"
 )
 
 var configLock sync.Mutex
-var globalConfig Config
+
+// globalConfig 是当前生效的配置，重新加载时整体替换为新的快照，通过 currentConfig 读取，读取方不能修改其内容
+var globalConfig atomic.Pointer[Config]
+
+// currentConfig 返回当前生效的配置快照
+func currentConfig() *Config {
+	if cfg := globalConfig.Load(); cfg != nil {
+		return cfg
+	}
+	return &Config{}
+}
 var configPath = "anyrun.toml"
 
 func reloadConfig() {
@@ -21,37 +32,21 @@ func reloadConfig() {
 	defer configLock.Unlock()
 	cfg, err := LoadConfig(configPath)
 	if err == nil {
-		globalConfig = cfg
+		if errs := cfg.Validate(); errs != nil {
+			err = errs
+		}
+	}
+	if err == nil {
+		// 应用配置有变化时在后台停止、启动或重启相应的应用
+		if old := currentConfig(); !reflect.DeepEqual(old.Apps, cfg.Apps) {
+			queueReconcile(*old, cfg)
+		}
+		globalConfig.Store(&cfg)
 	} else {
 		fmt.Printf("加载配置文件出错: %v\n", err)
 	}
 }
 
-func saveConfig(cfg Config) error {
-	configLock.Lock()
-	defer configLock.Unlock()
-	f, err := os.Create(configPath)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	f.WriteString(fmt.Sprintf("uiPort = %d\n\n", cfg.UIPort))
-	for _, app := range cfg.Apps {
-		f.WriteString("[[apps]]\n")
-		f.WriteString(fmt.Sprintf("name = \"%s\"\n", app.Name))
-		f.WriteString(fmt.Sprintf("execute = \"%s\"\n", app.Execute))
-		f.WriteString(fmt.Sprintf("appPath = \"%s\"\n", app.AppPath))
-		f.WriteString(fmt.Sprintf("appType = \"%s\"\n", app.AppType))
-		f.WriteString(fmt.Sprintf("daemon = %v\n", app.Daemon))
-		f.WriteString(fmt.Sprintf("args = \"%s\"\n", app.Args))
-		f.WriteString(fmt.Sprintf("autostart = %v\n", app.Autostart))
-		f.WriteString(fmt.Sprintf("timeout = %d\n", app.Timeout))
-		f.WriteString(fmt.Sprintf("port = %d\n", app.Port))
-		f.WriteString("\n")
-	}
-	return nil
-}
-
 // 生成密码哈希
 func generatePasswordHash(password string) string {
 	// 使用简单的MD5哈希（生产环境应使用更安全的方法）
@@ -59,19 +54,43 @@ func generatePasswordHash(password string) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// configUser 返回配置中的 [user]，配置文件中没有 [user] 时为首次登录的默认用户 admin
+func configUser() *UserConfig {
+	if user := currentConfig().User; user != nil {
+		return user
+	}
+	return &UserConfig{Username: "admin", FirstLogin: true}
+}
+
 // 验证用户登录
 func authenticate(username, password string) bool {
-	if globalConfig.User == nil {
-		return false
-	}
-	if globalConfig.User.Username != username {
+	user := configUser()
+	if user.Username != username {
 		return false
 	}
 	// 如果是首次登录，密码可以为空
-	if globalConfig.User.FirstLogin && globalConfig.User.PasswordHash == "" {
+	if user.FirstLogin && user.PasswordHash == "" {
 		return true
 	}
-	return globalConfig.User.PasswordHash == generatePasswordHash(password)
+	return user.PasswordHash == generatePasswordHash(password)
+}
+
+// processErrorStatus 把启动/停止应用的错误映射为 HTTP 状态码：非法状态转换返回 409
+func processErrorStatus(err error) int {
+	if isTransitionError(err) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// formatAppErrors 把每个应用的错误格式化为按应用名排序的列表
+func formatAppErrors(errs map[string]error, suffix string) []string {
+	failedApps := []string{}
+	for name, err := range errs {
+		failedApps = append(failedApps, fmt.Sprintf("%s%s: %v", name, suffix, err))
+	}
+	sort.Strings(failedApps)
+	return failedApps
 }
 
 // 认证中间件
@@ -83,14 +102,23 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 		
+		// 通过本机 Unix 域套接字访问时由文件权限保证安全，不需要 token
+		if isLocalSocketRequest(r) {
+			next(w, r)
+			return
+		}
+		
 		// 检查是否需要认证
-		if globalConfig.User == nil || (globalConfig.User.PasswordHash == "" && !globalConfig.User.FirstLogin) {
+		if user := configUser(); user.PasswordHash == "" && !user.FirstLogin {
 			next(w, r)
 			return
 		}
 		
-		// 从请求头获取token
+		// 从请求头获取token，EventSource 和 WebSocket 无法设置请求头，允许通过 token 参数传递
 		token := r.Header.Get("Authorization")
+		if token == "" && r.URL.Query().Get("token") != "" {
+			token = "Bearer " + r.URL.Query().Get("token")
+		}
 		if token == "" {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -107,8 +135,10 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 }
 
 func StartAPIServer(apps []AppConfig, uiPort int) {
-	globalConfig = Config{UIPort: uiPort, Apps: apps}
+	globalConfig.Store(&Config{UIPort: uiPort, Apps: apps})
 	reloadConfig()
+	// 配置文件变化或收到 SIGHUP 时重新加载配置
+	go watchConfig(findConfigFile(configPath))
 	
 	// 认证相关API
 	http.HandleFunc("/api/auth/login", func(w http.ResponseWriter, r *http.Request) {
@@ -128,11 +158,12 @@ func StartAPIServer(apps []AppConfig, uiPort int) {
 		}
 		
 		if authenticate(loginData.Username, loginData.Password) {
+			firstLogin := configUser().FirstLogin
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(map[string]interface{}{
 				"success":    true,
 				"token":      "anyrun-token",
-				"firstLogin": globalConfig.User.FirstLogin,
+				"firstLogin": firstLogin,
 			})
 		} else {
 			http.Error(w, "Invalid username or password", http.StatusUnauthorized)
@@ -142,17 +173,11 @@ func StartAPIServer(apps []AppConfig, uiPort int) {
 	// 获取用户配置
 	http.HandleFunc("/api/auth/user-config", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		if globalConfig.User == nil {
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"firstLogin": true,
-				"username":   "admin",
-			})
-		} else {
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"firstLogin": globalConfig.User.FirstLogin,
-				"username":   globalConfig.User.Username,
-			})
-		}
+		user := configUser()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"firstLogin": user.FirstLogin,
+			"username":   user.Username,
+		})
 	})
 	
 	// 修改密码
@@ -179,16 +204,15 @@ func StartAPIServer(apps []AppConfig, uiPort int) {
 			return
 		}
 		
-		// 更新密码
-		if globalConfig.User == nil {
-			globalConfig.User = &UserConfig{}
-		}
-		globalConfig.User.Username = passwordData.Username
-		globalConfig.User.PasswordHash = generatePasswordHash(passwordData.NewPassword)
-		globalConfig.User.FirstLogin = false
-		
-		// 保存配置
-		if err := saveConfig(globalConfig); err != nil {
+		// 更新密码，只修改配置文件中的 [user]，运行时叠加的 profile 不会写回基础配置
+		_, err := updateConfig("", func(cfg *Config) error {
+			cfg.User = &UserConfig{
+				Username:     passwordData.Username,
+				PasswordHash: generatePasswordHash(passwordData.NewPassword),
+			}
+			return nil
+		})
+		if err != nil {
 			http.Error(w, "Failed to save config", http.StatusInternalServerError)
 			return
 		}
@@ -200,28 +224,21 @@ func StartAPIServer(apps []AppConfig, uiPort int) {
 	})
 	
 	// API路由（带认证）
-	http.HandleFunc("/api/apps", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		reloadConfig()
-		var statuses []AppStatus
-		// 为配置中的每个应用创建状态条目，即使它们未运行
-		for _, app := range globalConfig.Apps {
-			status := QueryStatus(app)
-			statuses = append(statuses, status)
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(statuses)
-	}))
+	// 应用定义的增删改查、全局设置和运行状态
+	registerAppHandlers()
 
 	http.HandleFunc("/api/start", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		name := r.URL.Query().Get("name")
 		found := false
 		reloadConfig()
-		for _, app := range globalConfig.Apps {
+		cfg := currentConfig()
+		for _, app := range cfg.Apps {
 			if app.Name == name {
 				found = true
-				err := StartApp(app)
+				// 先启动尚未运行的依赖
+				err := startWithDependencies(cfg.Apps, []string{name})[name]
 				if err != nil {
-					http.Error(w, fmt.Sprintf("Failed to start app '%s': %v", name, err), 500)
+					http.Error(w, fmt.Sprintf("Failed to start app '%s': %v", name, err), processErrorStatus(err))
 					return
 				}
 				w.Header().Set("Content-Type", "text/plain")
@@ -233,18 +250,19 @@ func StartAPIServer(apps []AppConfig, uiPort int) {
 			http.Error(w, fmt.Sprintf("App '%s' not found", name), 404)
 			return
 		}
-	})
+	}))
 	
 	http.HandleFunc("/api/stop", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		name := r.URL.Query().Get("name")
 		found := false
 		reloadConfig()
-		for _, app := range globalConfig.Apps {
+		cfg := currentConfig()
+		for _, app := range cfg.Apps {
 			if app.Name == name {
 				found = true
 				err := StopApp(app)
 				if err != nil {
-					http.Error(w, fmt.Sprintf("Failed to stop app '%s': %v", name, err), 500)
+					http.Error(w, fmt.Sprintf("Failed to stop app '%s': %v", name, err), processErrorStatus(err))
 					return
 				}
 				w.Header().Set("Content-Type", "text/plain")
@@ -256,18 +274,13 @@ func StartAPIServer(apps []AppConfig, uiPort int) {
 			http.Error(w, fmt.Sprintf("App '%s' not found", name), 404)
 			return
 		}
-	})
+	}))
 	
-	// 全局操作接口
+	// 全局操作接口，按依赖顺序启动和停止
 	http.HandleFunc("/api/apps/startall", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		reloadConfig()
-		failedApps := []string{}
-		for _, app := range globalConfig.Apps {
-			err := StartApp(app)
-			if err != nil {
-				failedApps = append(failedApps, fmt.Sprintf("%s: %v", app.Name, err))
-			}
-		}
+		cfg := currentConfig()
+		failedApps := formatAppErrors(startWithDependencies(cfg.Apps, appNames(cfg.Apps)), "")
 		w.Header().Set("Content-Type", "text/plain")
 		if len(failedApps) > 0 {
 			w.WriteHeader(500)
@@ -275,17 +288,12 @@ func StartAPIServer(apps []AppConfig, uiPort int) {
 			return
 		}
 		w.Write([]byte("ok"))
-	})
+	}))
 	
 	http.HandleFunc("/api/apps/stopall", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		reloadConfig()
-		failedApps := []string{}
-		for _, app := range globalConfig.Apps {
-			err := StopApp(app)
-			if err != nil {
-				failedApps = append(failedApps, fmt.Sprintf("%s: %v", app.Name, err))
-			}
-		}
+		cfg := currentConfig()
+		failedApps := formatAppErrors(stopWithDependents(cfg.Apps, appNames(cfg.Apps)), "")
 		w.Header().Set("Content-Type", "text/plain")
 		if len(failedApps) > 0 {
 			w.WriteHeader(500)
@@ -293,27 +301,24 @@ func StartAPIServer(apps []AppConfig, uiPort int) {
 			return
 		}
 		w.Write([]byte("ok"))
-	})
+	}))
 	
 	http.HandleFunc("/api/apps/restartall", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		reloadConfig()
+		cfg := currentConfig()
 		failedApps := []string{}
 		
-		// 先停止所有应用
-		for _, app := range globalConfig.Apps {
-			err := StopApp(app)
-			if err != nil && err.Error() != "app not running" {
-				failedApps = append(failedApps, fmt.Sprintf("%s (stop): %v", app.Name, err))
+		// 先按依赖的逆序停止所有应用，未运行的应用不算失败
+		stopErrs := stopWithDependents(cfg.Apps, appNames(cfg.Apps))
+		for name, err := range stopErrs {
+			if isTransitionError(err) {
+				delete(stopErrs, name)
 			}
 		}
+		failedApps = append(failedApps, formatAppErrors(stopErrs, " (stop)")...)
 		
-		// 再启动所有应用
-		for _, app := range globalConfig.Apps {
-			err := StartApp(app)
-			if err != nil {
-				failedApps = append(failedApps, fmt.Sprintf("%s (start): %v", app.Name, err))
-			}
-		}
+		// 再按依赖顺序启动所有应用
+		failedApps = append(failedApps, formatAppErrors(startWithDependencies(cfg.Apps, appNames(cfg.Apps)), " (start)")...)
 		
 		w.Header().Set("Content-Type", "text/plain")
 		if len(failedApps) > 0 {
@@ -322,30 +327,102 @@ func StartAPIServer(apps []AppConfig, uiPort int) {
 			return
 		}
 		w.Write([]byte("ok"))
-	})
+	}))
+	
+	// 应用日志接口，支持 tail/since/follow 参数以及 SSE 和 WebSocket 推送
+	http.HandleFunc("/api/apps/{name}/logs", authMiddleware(AppLogsHandler))
 	
 	// 配置读取接口
 	http.HandleFunc("/api/config", authMiddleware(ConfigHandler))
 	
 	// 配置写入接口
 	http.HandleFunc("/api/config/save", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		var cfg Config
-		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		// 保存时必须带上读取配置时得到的 ETag，避免覆盖其他人的修改
+		ifMatch := r.Header.Get("If-Match")
+		if ifMatch == "" {
+			http.Error(w, "If-Match header with the config ETag is required", http.StatusPreconditionRequired)
+			return
+		}
+		var posted Config
+		if err := json.NewDecoder(r.Body).Decode(&posted); err != nil {
 			http.Error(w, fmt.Sprintf("Failed to decode config: %v", err), 400)
 			return
 		}
-		if err := saveConfig(cfg); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to save config: %v", err), 500)
+		revision, err := updateConfig(ifMatch, func(cfg *Config) error {
+			// 前端提交的配置不包含 [user]、include 和模板时，保留配置文件中的原有内容
+			if posted.User == nil {
+				posted.User = cfg.User
+			}
+			if posted.Include == nil {
+				posted.Include = cfg.Include
+			}
+			if posted.Templates == nil {
+				posted.Templates = cfg.Templates
+			}
+			*cfg = posted
+			return nil
+		})
+		if err == errConfigChanged {
+			// 配置已被修改，返回当前的配置和版本号
+			writeConfigResponse(w, http.StatusPreconditionFailed)
+			return
+		}
+		if err != nil {
+			writeConfigError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"`+revision+`"`)
+		w.Write([]byte("ok"))
+	}))
+	
+	// 配置文件历史版本：列出、查看、比较和回滚
+	http.HandleFunc("GET /api/config/history", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		versions, err := listConfigVersions()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list config versions: %v", err), 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(versions)
+	}))
+	http.HandleFunc("GET /api/config/history/diff", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		diff, err := diffConfigVersions(findConfigFile(configPath), r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+		if err != nil {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(diff))
+	}))
+	http.HandleFunc("GET /api/config/history/{id}", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		data, err := readConfigVersion(findConfigFile(configPath), r.PathValue("id"))
+		if err != nil {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(data)
+	}))
+	http.HandleFunc("POST /api/config/history/{id}/rollback", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		configLock.Lock()
+		err := rollbackConfig(findConfigFile(configPath), r.PathValue("id"))
+		configLock.Unlock()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to roll back config: %v", err), 400)
 			return
 		}
 		reloadConfig()
 		w.Header().Set("Content-Type", "text/plain")
 		w.Write([]byte("ok"))
-	})
+	}))
 	
 	// 静态文件服务
 	http.Handle("/", ServeFrontend())
 	
+	// 本机 CLI 通过 Unix 域套接字访问同一组 API
+	go serveUnixSocket(http.DefaultServeMux)
+	
 	addr := fmt.Sprintf(":%d", uiPort)
 	fmt.Printf("AnyRun服务已启动: http://localhost:%d\n", uiPort)
 	http.ListenAndServe(addr, nil)
@@ -355,9 +432,13 @@ func StartAPIServer(apps []AppConfig, uiPort int) {
 func ConfigHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("收到 /api/config 请求，请求方法: %s", r.Method)
 	log.Printf("请求头: %v", r.Header)
-	
-	// 加载配置文件
-	config, err := LoadConfig(configPath)
+	writeConfigResponse(w, http.StatusOK)
+}
+
+// writeConfigResponse 返回当前配置文件的内容，ETag 为配置的版本号，保存时通过 If-Match 带回
+func writeConfigResponse(w http.ResponseWriter, status int) {
+	// 加载配置文件，版本号与返回的内容来自同一次读取
+	config, _, revision, err := readConfig()
 	if err != nil {
 		log.Printf("加载配置文件失败: %v", err)
 		http.Error(w, "加载配置文件失败: "+err.Error(), http.StatusInternalServerError)
@@ -366,42 +447,19 @@ func ConfigHandler(w http.ResponseWriter, r *http.Request) {
 	
 	log.Printf("配置加载完成，UI端口: %d, 应用数量: %d", config.UIPort, len(config.Apps))
 	
-	// 准备响应数据，使用前端期望的字段名格式
-	type AppResponse struct {
-		Name     string `json:"name"`
-		Execute  string `json:"execute"`
-		AppPath  string `json:"appPath"`
-		AppType  string `json:"appType"`
-		Daemon   bool   `json:"daemon"`
-		Args     string `json:"args"`
-		Autostart bool  `json:"autostart"`
-		Timeout  int    `json:"timeout"`
-		Port     int    `json:"port"`
-	}
-	
+	// 准备响应数据，应用直接使用 AppConfig 的 JSON 字段，保存时原样提交回来
 	type ConfigResponse struct {
 		UIPort int           `json:"uiPort"`
-		Apps   []AppResponse `json:"apps"`
-	}
-	
-	apps := make([]AppResponse, len(config.Apps))
-	for i, app := range config.Apps {
-		apps[i] = AppResponse{
-			Name:      app.Name,
-			Execute:   app.Execute,
-			AppPath:   app.AppPath,
-			AppType:   app.AppType,
-			Daemon:    app.Daemon,
-			Args:      app.Args,
-			Autostart: app.Autostart,
-			Timeout:   app.Timeout,
-			Port:      app.Port,
-		}
+		Apps   []AppConfig   `json:"apps"`
+		Logs   *LogConfig    `json:"logs,omitempty"`
+		Templates map[string]AppConfig `json:"templates,omitempty"`
 	}
 	
 	response := ConfigResponse{
 		UIPort: config.UIPort,
-		Apps:   apps,
+		Apps:   config.Apps,
+		Logs:   config.Logs,
+		Templates: config.Templates,
 	}
 	
 	// 编码为JSON
@@ -417,7 +475,8 @@ func ConfigHandler(w http.ResponseWriter, r *http.Request) {
 	// 设置响应头并返回数据
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("ETag", `"`+revision+`"`)
+	w.WriteHeader(status)
 	
 	n, err := w.Write(data)
 	if err != nil {
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+var (
+	errAppNotFound = errors.New("app not found")
+	errAppExists   = errors.New("app already exists")
+)
+
+// requestError 表示请求内容本身有误，返回 400
+type requestError struct {
+	err error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+// Settings 是配置中除应用和用户之外的全局设置
+type Settings struct {
+	UIPort int        `json:"uiPort"`
+	Logs   *LogConfig `json:"logs,omitempty"`
+}
+
+// appListEntry 是 GET /api/apps 返回的一项：应用的运行状态（与之前的返回格式相同），
+// 加上配置文件中的应用定义
+type appListEntry struct {
+	AppStatus
+	Config *AppConfig `json:"config,omitempty"`
+}
+
+// loadConfigFile 读取并解析当前的配置（包括 include 引入的文件），同时返回其版本号
+func loadConfigFile() (Config, string, error) {
+	cfg, _, revision, err := readConfig()
+	return cfg, revision, err
+}
+
+// updateConfig 读取当前配置，由 update 修改其中的一部分，校验通过后写回并重新加载，
+// 其余部分（包括 [user]）保持不变，来自 include 文件的应用写回原来的文件。
+// ifMatch 非空时配置必须仍是该版本，否则返回 errConfigChanged。
+func updateConfig(ifMatch string, update func(cfg *Config) error) (string, error) {
+	configLock.Lock()
+	cfg, files, revision, err := readConfig()
+	if err == nil && ifMatch != "" && !etagMatches(ifMatch, revision) {
+		err = errConfigChanged
+	}
+	current := cfg
+	if err == nil {
+		err = update(&cfg)
+		// 修改后的配置与文件中的行号不再对应
+		cfg.lines, cfg.files = nil, nil
+	}
+	if err == nil {
+		if errs := cfg.Validate(); errs != nil {
+			err = errs
+		}
+	}
+	if err == nil {
+		if files, err = writeConfigFiles(files, cfg, current); err == nil {
+			revision = configFilesRevision(files)
+		}
+	}
+	configLock.Unlock()
+	if err != nil {
+		return "", err
+	}
+	reloadConfig()
+	return revision, nil
+}
+
+// writeConfigError 把 updateConfig 的错误转换为 HTTP 响应
+func writeConfigError(w http.ResponseWriter, err error) {
+	var errs ValidationErrors
+	var reqErr *requestError
+	switch {
+	case errors.As(err, &reqErr):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.As(err, &errs):
+		writeJSON(w, http.StatusUnprocessableEntity, "", map[string]interface{}{"errors": errs})
+	case errors.Is(err, errConfigChanged):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	case errors.Is(err, errAppNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errAppExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, fmt.Sprintf("Failed to save config: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// writeJSON 返回 JSON 响应，revision 非空时设置 ETag
+func writeJSON(w http.ResponseWriter, status int, revision string, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if revision != "" {
+		w.Header().Set("ETag", `"`+revision+`"`)
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// decodeJSON 解析请求体，不允许未知字段
+func decodeJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// decodeApp 解析应用的 JSON 定义，不允许未知字段。引用了 templates 中的模板时在模板的基础上解析，
+// 没有出现的配置使用模板的值（子表按键合并），与配置文件中引用模板的规则相同
+func decodeApp(data []byte, templates map[string]AppConfig) (AppConfig, error) {
+	decode := func(app *AppConfig) error {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		return dec.Decode(app)
+	}
+	var app AppConfig
+	if err := decode(&app); err != nil {
+		return app, err
+	}
+	if tmpl, ok := templates[app.Template]; ok && app.Template != "" {
+		app = cloneApp(tmpl)
+		if err := decode(&app); err != nil {
+			return app, err
+		}
+	}
+	return app, nil
+}
+
+// findAppIndex 返回应用在配置中的下标，不存在时返回 -1
+func findAppIndex(cfg *Config, name string) int {
+	if i, ok := cfg.findApp(name); ok {
+		return i
+	}
+	return -1
+}
+
+// checkAppName 检查请求体中的应用名称与 URL 中的一致，名称为空时使用 URL 中的名称
+func checkAppName(app *AppConfig, name string) error {
+	if app.Name == "" {
+		app.Name = name
+	}
+	if app.Name != name {
+		return ValidationErrors{{Path: "name", Message: "renaming an app is not supported, delete it and create a new one"}}
+	}
+	return nil
+}
+
+// mergePatch 按 JSON Merge Patch（RFC 7386）把 patch 合并到 target，值为 null 的键被删除
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for key, val := range p {
+		if val == nil {
+			delete(t, key)
+		} else {
+			t[key] = mergePatch(t[key], val)
+		}
+	}
+	return t
+}
+
+// patchApp 把 JSON Merge Patch 应用到应用配置，删除的配置恢复为引用的模板中的值
+func patchApp(app AppConfig, patch []byte, templates map[string]AppConfig) (AppConfig, error) {
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return app, err
+	}
+	if _, ok := p.(map[string]interface{}); !ok {
+		return app, fmt.Errorf("patch must be a JSON object")
+	}
+	data, err := json.Marshal(app)
+	if err != nil {
+		return app, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return app, err
+	}
+	data, err = json.Marshal(mergePatch(doc, p))
+	if err != nil {
+		return app, err
+	}
+	patched, err := decodeApp(data, templates)
+	if err != nil {
+		return app, err
+	}
+	return patched, nil
+}
+
+// registerAppHandlers 注册应用定义和全局设置的增删改查接口，GET /api/apps 同时返回应用的运行状态。
+// 每个接口只修改配置中对应的部分；请求带 If-Match 时只在配置仍是该版本时修改。
+func registerAppHandlers() {
+	http.HandleFunc("/api/apps", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			reloadConfig()
+			cfg, revision, err := loadConfigFile()
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to load config: %v", err), 500)
+				return
+			}
+			// 为配置中的每个应用创建状态条目，即使它们未运行
+			entries := []appListEntry{}
+			for _, app := range currentConfig().Apps {
+				entry := appListEntry{AppStatus: QueryStatus(app)}
+				if i := findAppIndex(&cfg, app.Name); i >= 0 {
+					entry.Config = &cfg.Apps[i]
+				}
+				entries = append(entries, entry)
+			}
+			writeJSON(w, http.StatusOK, revision, entries)
+		case "POST":
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid app: %v", err), 400)
+				return
+			}
+			app, err := decodeApp(body, nil)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid app: %v", err), 400)
+				return
+			}
+			if app.Name == "" {
+				writeConfigError(w, ValidationErrors{{Path: "name", Message: "name is required"}})
+				return
+			}
+			revision, err := updateConfig(r.Header.Get("If-Match"), func(cfg *Config) error {
+				if findAppIndex(cfg, app.Name) >= 0 {
+					return fmt.Errorf("%w: '%s'", errAppExists, app.Name)
+				}
+				// 引用了模板时以模板为基础
+				app, _ = decodeApp(body, cfg.Templates)
+				cfg.Apps = append(cfg.Apps, app)
+				return nil
+			})
+			if err != nil {
+				writeConfigError(w, err)
+				return
+			}
+			w.Header().Set("Location", "/api/apps/"+url.PathEscape(app.Name))
+			writeJSON(w, http.StatusCreated, revision, app)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+
+	http.HandleFunc("/api/apps/{name}", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		var app AppConfig
+		var update func(cfg *Config) error
+		switch r.Method {
+		case "GET":
+			cfg, revision, err := loadConfigFile()
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to load config: %v", err), 500)
+				return
+			}
+			i := findAppIndex(&cfg, name)
+			if i < 0 {
+				http.Error(w, fmt.Sprintf("App '%s' not found", name), 404)
+				return
+			}
+			writeJSON(w, http.StatusOK, revision, cfg.Apps[i])
+			return
+		case "PUT":
+			body, err := io.ReadAll(r.Body)
+			if err == nil {
+				app, err = decodeApp(body, nil)
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid app: %v", err), 400)
+				return
+			}
+			if err := checkAppName(&app, name); err != nil {
+				writeConfigError(w, err)
+				return
+			}
+			update = func(cfg *Config) error {
+				i := findAppIndex(cfg, name)
+				if i < 0 {
+					return fmt.Errorf("%w: '%s'", errAppNotFound, name)
+				}
+				// 引用了模板时以模板为基础
+				app, _ = decodeApp(body, cfg.Templates)
+				checkAppName(&app, name)
+				cfg.Apps[i] = app
+				return nil
+			}
+		case "PATCH":
+			patch, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid patch: %v", err), 400)
+				return
+			}
+			update = func(cfg *Config) error {
+				i := findAppIndex(cfg, name)
+				if i < 0 {
+					return fmt.Errorf("%w: '%s'", errAppNotFound, name)
+				}
+				patched, err := patchApp(cfg.Apps[i], patch, cfg.Templates)
+				if err != nil {
+					return &requestError{fmt.Errorf("invalid patch: %v", err)}
+				}
+				if err := checkAppName(&patched, name); err != nil {
+					return err
+				}
+				app = patched
+				cfg.Apps[i] = app
+				return nil
+			}
+		case "DELETE":
+			update = func(cfg *Config) error {
+				i := findAppIndex(cfg, name)
+				if i < 0 {
+					return fmt.Errorf("%w: '%s'", errAppNotFound, name)
+				}
+				cfg.Apps = append(cfg.Apps[:i], cfg.Apps[i+1:]...)
+				return nil
+			}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		revision, err := updateConfig(r.Header.Get("If-Match"), update)
+		if err != nil {
+			writeConfigError(w, err)
+			return
+		}
+		if r.Method == "DELETE" {
+			w.Header().Set("ETag", `"`+revision+`"`)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, http.StatusOK, revision, app)
+	}))
+
+	http.HandleFunc("/api/settings", authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			cfg, revision, err := loadConfigFile()
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to load config: %v", err), 500)
+				return
+			}
+			writeJSON(w, http.StatusOK, revision, Settings{UIPort: cfg.UIPort, Logs: cfg.Logs})
+		case "PUT":
+			var settings Settings
+			if err := decodeJSON(r, &settings); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid settings: %v", err), 400)
+				return
+			}
+			revision, err := updateConfig(r.Header.Get("If-Match"), func(cfg *Config) error {
+				cfg.UIPort = settings.UIPort
+				cfg.Logs = settings.Logs
+				return nil
+			})
+			if err != nil {
+				writeConfigError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, revision, settings)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+}
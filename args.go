@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// AppArgs 是应用的启动参数。配置中可以写成字符串（按 POSIX shell 规则拆分，支持引号和转义），
+// 也可以写成字符串数组（每个元素是一个参数）；保存时保持原来的写法。
+type AppArgs struct {
+	Line  string   // 字符串写法
+	List  []string // 数组写法
+	Array bool     // 是否使用数组写法
+}
+
+// IsEmpty 判断是否没有配置参数
+func (a AppArgs) IsEmpty() bool {
+	if a.Array {
+		return len(a.List) == 0
+	}
+	return strings.TrimSpace(a.Line) == ""
+}
+
+// Fields 返回拆分后的参数列表
+func (a AppArgs) Fields() ([]string, error) {
+	if a.Array {
+		return a.List, nil
+	}
+	return splitShellWords(a.Line)
+}
+
+// ShellLine 返回交给 shell 执行的参数串：字符串写法原样返回，数组写法逐个加引号
+func (a AppArgs) ShellLine() string {
+	if a.Array {
+		return shellJoin(a.List)
+	}
+	return a.Line
+}
+
+// MarshalJSON 按配置中的写法输出字符串或数组
+func (a AppArgs) MarshalJSON() ([]byte, error) {
+	if a.Array {
+		if a.List == nil {
+			return []byte("[]"), nil
+		}
+		return json.Marshal(a.List)
+	}
+	return json.Marshal(a.Line)
+}
+
+// UnmarshalJSON 接受字符串或字符串数组
+func (a *AppArgs) UnmarshalJSON(data []byte) error {
+	var line string
+	if err := json.Unmarshal(data, &line); err == nil {
+		*a = AppArgs{Line: line}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("args must be a string or an array of strings")
+	}
+	*a = AppArgs{List: list, Array: true}
+	return nil
+}
+
+// TOML 返回参数在 TOML 中的写法
+func (a AppArgs) TOML() string {
+	if a.Array {
+		items := make([]string, len(a.List))
+		for i, item := range a.List {
+			items[i] = quoteTOMLString(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return quoteTOMLString(a.Line)
+}
+
+// splitShellWords 按 POSIX shell 规则拆分参数：空白分隔，单引号内原样保留，
+// 双引号内反斜杠只转义 $ ` " \ 和换行，引号外反斜杠转义下一个字符。
+// Windows 上引号外的反斜杠按普通字符处理，以便直接书写 C:\tools\app.exe 这样的路径。
+func splitShellWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote in args")
+			}
+			word.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) && strings.IndexByte("$`\"\\\n", line[i+1]) >= 0 {
+					i++
+					if line[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return nil, fmt.Errorf("unterminated double quote in args")
+			}
+			inWord = true
+		case c == '\\' && runtime.GOOS != "windows":
+			if i+1 >= len(line) {
+				return nil, fmt.Errorf("trailing backslash in args")
+			}
+			i++
+			if line[i] != '\n' {
+				word.WriteByte(line[i])
+				inWord = true
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// shellQuote 为 shell 命令行中的一个参数加引号
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		if s != "" && !strings.ContainsAny(s, " \t\"") {
+			return s
+		}
+		return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+	}
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+./:,@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellJoin 把参数列表拼成 shell 命令行
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
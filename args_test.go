@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestSplitShellWords(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"  -a   -b\t-c  ", []string{"-a", "-b", "-c"}, false},
+		{`-Dname="a b" --path 'C:\Program Files'`, []string{"-Dname=a b", "--path", `C:\Program Files`}, false},
+		{`"a \"quoted\" \$HOME"`, []string{`a "quoted" $HOME`}, false},
+		{`'it'"'"'s'`, []string{"it's"}, false},
+		{`""`, []string{""}, false},
+		{`"unterminated`, nil, true},
+		{`'unterminated`, nil, true},
+	}
+	if runtime.GOOS != "windows" {
+		tests = append(tests, []struct {
+			line    string
+			want    []string
+			wantErr bool
+		}{
+			{`a\ b c`, []string{"a b", "c"}, false},
+			{`trailing\`, nil, true},
+		}...)
+	}
+	for _, tt := range tests {
+		got, err := splitShellWords(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitShellWords(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitShellWords(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestShellJoinRoundTrip(t *testing.T) {
+	for _, args := range [][]string{
+		{"java", "-jar", "my app.jar"},
+		{"echo", "it's", `"quoted"`, "$HOME", ""},
+	} {
+		got, err := splitShellWords(shellJoin(args))
+		if err != nil || !reflect.DeepEqual(got, args) {
+			t.Errorf("splitShellWords(shellJoin(%q)) = %q, %v", args, got, err)
+		}
+	}
+}
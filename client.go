@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// socketPath 是 anyrun 服务监听的 Unix 域套接字，本机 CLI 通过它访问服务而无需 token
+var socketPath = filepath.Join(stateDir, "anyrun.sock")
+
+// localConnKey 标记通过 Unix 域套接字到达的请求
+type localConnKey struct{}
+
+// isLocalSocketRequest 判断请求是否来自 Unix 域套接字
+func isLocalSocketRequest(r *http.Request) bool {
+	local, _ := r.Context().Value(localConnKey{}).(bool)
+	return local
+}
+
+// serveUnixSocket 在 socketPath 上提供与 HTTP 端口相同的 API
+func serveUnixSocket(handler http.Handler) {
+	if conn, err := net.Dial("unix", socketPath); err == nil {
+		conn.Close()
+		fmt.Printf("警告: %s 已被另一个 anyrun 服务使用\n", socketPath)
+		return
+	}
+	// 清理上次异常退出留下的套接字文件
+	os.Remove(socketPath)
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0755); err != nil {
+		fmt.Printf("创建套接字目录失败: %v\n", err)
+		return
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		fmt.Printf("监听 %s 失败: %v\n", socketPath, err)
+		return
+	}
+	os.Chmod(socketPath, 0600)
+	server := &http.Server{
+		Handler: handler,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, localConnKey{}, true)
+		},
+	}
+	server.Serve(listener)
+}
+
+// daemonClient 通过 Unix 域套接字或 HTTP API 访问正在运行的 anyrun 服务
+type daemonClient struct {
+	http  *http.Client
+	base  string
+	token string
+}
+
+// newDaemonClient 优先连接 Unix 域套接字，失败时回退到 uiPort 上的 HTTP API
+func newDaemonClient(uiPort int, token string) (*daemonClient, error) {
+	if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+		conn.Close()
+		return &daemonClient{
+			http: &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			}},
+			base: "http://anyrun",
+		}, nil
+	}
+
+	c := &daemonClient{
+		http:  &http.Client{Timeout: 10 * time.Minute},
+		base:  fmt.Sprintf("http://127.0.0.1:%d", uiPort),
+		token: token,
+	}
+	resp, err := c.http.Get(c.base + "/api/auth/user-config")
+	if err != nil {
+		return nil, fmt.Errorf("无法连接 anyrun 服务（%s 或 %s）: %v", socketPath, c.base, err)
+	}
+	resp.Body.Close()
+	return c, nil
+}
+
+// do 发送请求，非 2xx 响应转换为错误
+func (c *daemonClient) do(method, path string) ([]byte, error) {
+	req, err := http.NewRequest(method, c.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("认证失败，请通过 --token 或 ANYRUN_TOKEN 提供 token")
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s", strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// Status 查询应用状态
+func (c *daemonClient) Status(name string) (AppStatus, error) {
+	body, err := c.do("GET", "/api/apps")
+	if err != nil {
+		return AppStatus{}, err
+	}
+	var statuses []AppStatus
+	if err := json.Unmarshal(body, &statuses); err != nil {
+		return AppStatus{}, err
+	}
+	for _, st := range statuses {
+		if st.Name == name {
+			return st, nil
+		}
+	}
+	return AppStatus{}, fmt.Errorf("应用 '%s' 未找到", name)
+}
+
+// Start 请求服务启动应用
+func (c *daemonClient) Start(name string) error {
+	_, err := c.do("POST", "/api/start?name="+url.QueryEscape(name))
+	return err
+}
+
+// Stop 请求服务停止应用
+func (c *daemonClient) Stop(name string) error {
+	_, err := c.do("POST", "/api/stop?name="+url.QueryEscape(name))
+	return err
+}
+
+// RunClientCommand 通过正在运行的 anyrun 服务执行 status/start/stop 命令
+func RunClientCommand(uiPort int, token, command, name string) error {
+	c, err := newDaemonClient(uiPort, token)
+	if err != nil {
+		return err
+	}
+	switch command {
+	case "status":
+		status, err := c.Status(name)
+		if err != nil {
+			return err
+		}
+		b, _ := json.MarshalIndent(status, "", "  ")
+		fmt.Println(string(b))
+	case "start":
+		fmt.Printf("启动应用: %s\n", name)
+		if err := c.Start(name); err != nil {
+			return fmt.Errorf("启动失败: %v", err)
+		}
+		fmt.Printf("应用 %s 启动成功\n", name)
+	case "stop":
+		fmt.Printf("停止应用: %s\n", name)
+		if err := c.Stop(name); err != nil {
+			return fmt.Errorf("停止失败: %v", err)
+		}
+		fmt.Printf("应用 %s 停止成功\n", name)
+	default:
+		return fmt.Errorf("未知命令: %s", command)
+	}
+	return nil
+}
@@ -1,52 +1,99 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"os"
-	"strconv"
+	"path/filepath"
+	"reflect"
 	"strings"
 )
 
 type AppConfig struct {
-	Name      string `json:"name"`
-	Execute   string `json:"execute"`   // 可执行器，例如: java, python, npm, /usr/bin/myprog
-	AppPath   string `json:"appPath"`   // 应用路径或脚本文件
-	AppType   string `json:"appType"`   // 应用类型：java|python|node|other
-	Daemon    bool   `json:"daemon"`
-	Args      string `json:"args"`
-	Autostart bool   `json:"autostart"`
-	Timeout   int    `json:"timeout"`
-	Port      int    `json:"port"` // 应用监听的端口
+	Name      string  `json:"name" toml:"name"`
+	Template  string  `json:"template,omitempty" toml:"template,omitempty"` // 引用的应用模板，未设置的配置使用模板中的值
+	Execute   string  `json:"execute" toml:"execute"` // 可执行器，例如: java, python, npm, /usr/bin/myprog
+	AppPath   string  `json:"appPath" toml:"appPath"` // 应用路径或脚本文件
+	AppType   string  `json:"appType" toml:"appType"` // 应用类型：java|python|node|other
+	Daemon    bool    `json:"daemon" toml:"daemon"`
+	Args      AppArgs `json:"args" toml:"args"` // 字符串（按 shell 规则拆分）或字符串数组
+	Autostart bool    `json:"autostart" toml:"autostart"`
+	Timeout   int     `json:"timeout" toml:"timeout"`       // 启动就绪与优雅停止的默认超时（秒）
+	Port      int     `json:"port" toml:"port"`             // 应用监听的端口
+	Shell     bool    `json:"shell" toml:"shell,omitempty"` // 通过 /bin/sh -c（Windows 上为 cmd.exe /C）执行命令
+
+	StartTimeout int    `json:"startTimeout" toml:"startTimeout,omitempty"` // 等待应用就绪的超时（秒），未设置时使用 timeout
+	StopTimeout  int    `json:"stopTimeout" toml:"stopTimeout,omitempty"`   // 发送停止信号后等待退出的超时（秒），未设置时使用 timeout
+	StopSignal   string `json:"stopSignal" toml:"stopSignal,omitempty"`     // 停止信号：SIGTERM|SIGINT|SIGQUIT|SIGHUP，默认 SIGTERM
+	KillMode     string `json:"killMode" toml:"killMode,omitempty"`         // 停止范围：group|process|cgroup，默认 group
+
+	// 重启策略
+	Restart        string `json:"restart" toml:"restart,omitempty"`               // always|on-failure|never，默认 never
+	MaxRetries     int    `json:"maxRetries" toml:"maxRetries,omitempty"`         // 连续重启次数上限，0 表示不限制
+	BackoffInitial int    `json:"backoffInitial" toml:"backoffInitial,omitempty"` // 首次重启前等待的秒数，之后按指数增长
+	BackoffMax     int    `json:"backoffMax" toml:"backoffMax,omitempty"`         // 重启等待时间上限（秒）
+	ResetWindow    int    `json:"resetWindow" toml:"resetWindow,omitempty"`       // 进程稳定运行超过该秒数后重置重试计数
+
+	DependsOn []string `json:"dependsOn,omitempty" toml:"dependsOn,omitempty"` // 依赖的应用，这些应用进入 running 后才启动本应用
+
+	RestartOnConfigChange *bool `json:"restartOnConfigChange,omitempty" toml:"restartOnConfigChange,omitempty"` // 启动相关配置变化时是否自动重启，默认 true
+
+	// 运行环境
+	WorkDir    string            `json:"workDir" toml:"workDir,omitempty"`                 // 工作目录，默认为 AppPath 所在目录
+	Env        map[string]string `json:"env,omitempty" toml:"env,omitempty"`               // [apps.env] 环境变量，覆盖 envFile 和继承的变量
+	EnvFile    string            `json:"envFile" toml:"envFile,omitempty"`                 // dotenv 格式的环境变量文件，相对路径基于工作目录
+	InheritEnv *bool             `json:"inheritEnv,omitempty" toml:"inheritEnv,omitempty"` // 是否继承 anyrun 的环境变量，默认 true
+
+	Healthcheck *HealthCheck `json:"healthcheck,omitempty" toml:"healthcheck,omitempty"` // [apps.healthcheck] 健康检查
+	Logs        *LogConfig   `json:"logs,omitempty" toml:"logs,omitempty"`               // [apps.logs] 覆盖全局日志配置
+
+	base *AppConfig // 写回配置文件时的默认值（引用的模板），与之相同的字段不写出
+}
+
+// HealthCheck 描述应用的健康检查方式
+type HealthCheck struct {
+	Type               string `json:"type" toml:"type"`                                       // http|tcp|exec
+	URL                string `json:"url" toml:"url,omitempty"`                               // http 检查地址，默认 http://127.0.0.1:<port>/
+	Address            string `json:"address" toml:"address,omitempty"`                       // tcp 检查地址，默认 127.0.0.1:<port>
+	Command            string `json:"command" toml:"command,omitempty"`                       // exec 检查命令，退出码为 0 视为健康
+	ExpectStatus       int    `json:"expectStatus" toml:"expectStatus,omitempty"`             // http 期望状态码，0 表示任意 2xx/3xx
+	ExpectBody         string `json:"expectBody" toml:"expectBody,omitempty"`                 // http 响应体需包含的子串
+	Interval           int    `json:"interval" toml:"interval,omitempty"`                     // 检查间隔（秒）
+	Timeout            int    `json:"timeout" toml:"timeout,omitempty"`                       // 单次检查超时（秒）
+	FailureThreshold   int    `json:"failureThreshold" toml:"failureThreshold,omitempty"`     // 连续失败多少次判定为 unhealthy
+	SuccessThreshold   int    `json:"successThreshold" toml:"successThreshold,omitempty"`     // 连续成功多少次判定为 healthy
+	RestartOnUnhealthy bool   `json:"restartOnUnhealthy" toml:"restartOnUnhealthy,omitempty"` // unhealthy 时按重启策略重启应用
 }
 
 type UserConfig struct {
-	Username       string `json:"username"`
-	PasswordHash   string `json:"passwordHash"`
-	FirstLogin     bool   `json:"firstLogin"`
+	Username     string `json:"username" toml:"username"`
+	PasswordHash string `json:"passwordHash" toml:"passwordHash"`
+	FirstLogin   bool   `json:"firstLogin" toml:"firstLogin"`
 }
 
 type Config struct {
-	UIPort int        `json:"uiPort"`
-	Apps   []AppConfig `json:"apps"`
-	User   *UserConfig `json:"user,omitempty"`
+	UIPort  int         `json:"uiPort" toml:"uiPort"`
+	Include []string    `json:"include,omitempty" toml:"include,omitempty"` // 引入其他配置文件中的应用，支持通配符，相对路径基于主配置文件所在目录
+	Apps    []AppConfig `json:"apps" toml:"apps"`
+	User    *UserConfig `json:"user,omitempty" toml:"user,omitempty"`
+	Logs    *LogConfig  `json:"logs,omitempty" toml:"logs,omitempty"` // [logs] 全局日志配置
+
+	Templates map[string]AppConfig `json:"templates,omitempty" toml:"templates,omitempty"` // [templates.<name>] 应用模板，应用通过 template = "<name>" 引用
+
+	lines map[string]int    // 字段路径对应的配置文件行号，用于校验错误定位
+	files map[string]string // 来自 include 文件的应用（apps[i]）对应的文件路径
 }
 
-// 简易TOML解析，支持全局 ui_port 与多个 [[apps]]
+// LoadConfig 读取配置文件（TOML、JSON 或 YAML，按扩展名区分），支持全局 uiPort、[user]、[logs] 与多个 [[apps]]，
+// 并合并 include 引入的文件（使用 /etc/anyrun 中的配置文件时还有 /etc/anyrun/conf.d 中的文件）中的应用
 func LoadConfig(path string) (Config, error) {
 	fmt.Printf("开始加载配置文件: %s\n", path)
-	
-	// 首先尝试加载当前目录的配置文件
-	if _, err := os.Stat("anyrun.toml"); err == nil {
-		path = "anyrun.toml"
-		fmt.Printf("使用当前目录配置文件: %s\n", path)
-	} else {
-		// 如果当前目录没有配置文件，尝试加载/etc/anyrun/anyrun.toml (Unix系统)
-		if _, err := os.Stat("/etc/anyrun/anyrun.toml"); err == nil {
-			path = "/etc/anyrun/anyrun.toml"
-			fmt.Printf("使用系统目录配置文件: %s\n", path)
-		}
+
+	if found := findConfigFile(path); found != path {
+		path = found
+		fmt.Printf("使用配置文件: %s\n", path)
 	}
-		data, err := os.ReadFile(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		fmt.Printf("读取配置文件失败: %v\n", err)
 		// 返回默认配置，包括用户配置
@@ -56,128 +103,150 @@ func LoadConfig(path string) (Config, error) {
 			User:   &UserConfig{Username: "admin", PasswordHash: "", FirstLogin: true},
 		}, err
 	}
-	
+
 	fmt.Printf("配置文件读取成功，大小: %d 字节\n", len(data))
-	lines := strings.Split(string(data), "\n")
-	var apps []AppConfig
-	var app *AppConfig = nil
-	cfg := Config{UIPort: 5173}
-	var inUserSection bool
-	cfg.User = &UserConfig{FirstLogin: true}
-	
-	for i, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		
-		// 用户配置区域
-		if strings.HasPrefix(line, "[user]") {
-			inUserSection = true
-			continue
+	cfg, files, err := loadConfigFiles(path, data)
+	for _, f := range files[1:] {
+		fmt.Printf("已加载 include 文件: %s\n", f.path)
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if configProfile != "" {
+		if err := applyProfile(&cfg, path, data, configProfile); err != nil {
+			return cfg, err
 		}
-		
-		// 全局 uiPort (驼峰或下划线都支持)
-		if strings.HasPrefix(line, "uiPort") || strings.HasPrefix(line, "ui_port") {
-			kv := strings.SplitN(line, "=", 2)
-			if len(kv) == 2 {
-				portStr := strings.TrimSpace(kv[1])
-				portStr = strings.Trim(portStr, "\"")
-				if p, err := strconv.Atoi(portStr); err == nil {
-					cfg.UIPort = p
-					fmt.Printf("解析到UI端口: %d\n", p)
-				} else {
-					fmt.Printf("解析UI端口失败: %v\n", err)
-				}
+		fmt.Printf("已应用配置 profile: %s\n", configProfile)
+	}
+	fmt.Printf("配置加载完成，共加载 %d 个应用\n", len(cfg.Apps))
+	return cfg, nil
+}
+
+// configPathSet 表示配置文件由 --config 参数指定，此时不再查找默认的位置
+var configPathSet bool
+
+// findConfigFile 返回实际使用的配置文件：--config 指定时使用 path；否则依次查找当前目录的
+// anyrun.toml、anyrun.json、anyrun.yaml、anyrun.yml，其次是 /etc/anyrun 中的同名文件（Unix 系统），
+// 都不存在时使用 path
+func findConfigFile(path string) string {
+	if configPathSet {
+		return path
+	}
+	for _, dir := range []string{"", systemConfigDir} {
+		for _, name := range configFileNames {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				return filepath.Join(dir, name)
 			}
-			continue
 		}
-		
-		if line == "[[apps]]" {
-			inUserSection = false
-			if app != nil && app.Name != "" {
-				fmt.Printf("添加应用: %s\n", app.Name)
-				apps = append(apps, *app)
-			}
-			app = &AppConfig{}
-			continue
+	}
+	return path
+}
+
+// parseConfig 解析配置文件 path 的内容 data，格式由扩展名决定，语法和类型错误带有行列位置
+func parseConfig(path string, data []byte) (Config, error) {
+	return decodeConfig(path, data, func(line int, key string) {
+		// [profiles.*] 在叠加 profile 时读取
+		if key == "profiles" {
+			return
 		}
-		
-		if app == nil {
-			// 检查是否在用户配置区域
-			if inUserSection {
-				kv := strings.SplitN(line, "=", 2)
-				if len(kv) != 2 {
-					continue
-				}
-				
-				key := strings.TrimSpace(kv[0])
-				val := strings.TrimSpace(kv[1])
-				// 去除引号
-				if strings.HasPrefix(val, "\"") && strings.HasSuffix(val, "\"") {
-					val = strings.Trim(val, "\"")
-				}
-				
-				switch key {
-				case "username":
-					cfg.User.Username = val
-				case "passwordHash":
-					cfg.User.PasswordHash = val
-				case "firstLogin":
-					cfg.User.FirstLogin = (val == "true" || val == "True" || val == "TRUE" || val == "1")
-				default:
-					fmt.Printf("未知用户配置项在第%d行: %s=%s\n", i+1, key, val)
-				}
-			}
-			continue
+		fmt.Printf("未知配置项在第%d行: %s\n", line, key)
+	})
+}
+
+// decodeConfig 解析配置内容，遇到未知配置项时调用 warn
+func decodeConfig(path string, data []byte, warn func(line int, key string)) (Config, error) {
+	// 没有 [user] 时 User 保持为 nil，保存配置时不会写出用户配置
+	cfg := Config{UIPort: 5173}
+	lines := map[string]int{}
+	if err := decodeConfigDocument(path, data, &cfg, lines, warn); err != nil {
+		return cfg, err
+	}
+	if err := expandTemplates(cfg.Apps, cfg.Templates, path, data); err != nil {
+		return cfg, err
+	}
+
+	apps := cfg.Apps
+	cfg.Apps = []AppConfig{}
+	cfg.lines = map[string]int{}
+	for path, line := range lines {
+		if !strings.HasPrefix(path, "apps[") {
+			cfg.lines[path] = line
 		}
-		
-		kv := strings.SplitN(line, "=", 2)
-		if len(kv) != 2 {
+	}
+	cfg.appendApps(apps, lines, "")
+	return cfg, nil
+}
+
+// appendApps 把一个文件中的应用追加到配置中，忽略没有名称的应用。lines 中应用字段的行号按新的下标
+// 记录到配置中；file 为应用所在的 include 文件，来自主配置文件时为空。
+func (c *Config) appendApps(apps []AppConfig, lines map[string]int, file string) {
+	if c.lines == nil {
+		c.lines = map[string]int{}
+	}
+	for i, app := range apps {
+		if app.Name == "" {
 			continue
 		}
-		
-		key := strings.TrimSpace(kv[0])
-		val := strings.TrimSpace(kv[1])
-		// 去除引号
-		if strings.HasPrefix(val, "\"") && strings.HasSuffix(val, "\"") {
-			val = strings.Trim(val, "\"")
-		}
-		
-		switch key {
-		case "name":
-			app.Name = val
-		case "execute":
-			app.Execute = val
-		case "appPath", "app_path":
-			app.AppPath = val
-		case "appType", "app_type":
-			app.AppType = val
-		case "daemon":
-			app.Daemon = (val == "true" || val == "True" || val == "TRUE" || val == "1")
-		case "args":
-			app.Args = val
-		case "autostart":
-			app.Autostart = (val == "true" || val == "True" || val == "TRUE" || val == "1")
-		case "timeout":
-			if t, err := strconv.Atoi(val); err == nil {
-				app.Timeout = t
+		from := fmt.Sprintf("apps[%d]", i)
+		to := fmt.Sprintf("apps[%d]", len(c.Apps))
+		for path, line := range lines {
+			if path == from || strings.HasPrefix(path, from+".") {
+				c.lines[to+path[len(from):]] = line
 			}
-		case "port":
-			if p, err := strconv.Atoi(val); err == nil {
-				app.Port = p
+		}
+		if file != "" {
+			if c.files == nil {
+				c.files = map[string]string{}
 			}
-		default:
-			fmt.Printf("未知配置项在第%d行: %s=%s\n", i+1, key, val)
+			c.files[to] = file
 		}
+		c.Apps = append(c.Apps, app)
 	}
-	
-	if app != nil && app.Name != "" {
-		fmt.Printf("添加最后一个应用: %s\n", app.Name)
-		apps = append(apps, *app)
+}
+
+// encodeConfig 把配置写成 TOML 文本，parseConfig 读回后得到相同的值
+func encodeConfig(cfg Config) []byte {
+	return []byte(encodeTOML(cfg))
+}
+
+// updateConfigDocument 把 v（Config 或 includeConfig）写入配置文件 path 原有的内容：TOML 只修改发生变化的键，
+// 保留注释、空行、键的顺序和未知的配置项，原内容为空、无法解析或使用了无法原地修改的写法时重新生成整个文件；
+// JSON 和 YAML 在配置发生变化时重新生成，见 encodeConfigDocument，YAML 中原有的注释不会保留。
+func updateConfigDocument(path string, original []byte, v interface{}) []byte {
+	if format := configFormat(path); format != formatTOML {
+		generated := encodeConfigDocument(path, original, v)
+		// 配置没有变化时保留原文件，包括其中的注释和写法
+		got := reflect.New(reflect.TypeOf(v))
+		want := reflect.New(reflect.TypeOf(v))
+		if decodeConfigDocument(path, original, got.Interface(), nil, nil) == nil &&
+			decodeConfigDocument(path, generated, want.Interface(), nil, nil) == nil &&
+			reflect.DeepEqual(got.Interface(), want.Interface()) {
+			return original
+		}
+		if format == formatYAML && yamlHasComments(original) {
+			fmt.Printf("警告: 重新生成配置文件 %s，其中的注释不会保留\n", path)
+		}
+		return generated
 	}
-	
-	cfg.Apps = apps
-	fmt.Printf("配置加载完成，共加载 %d 个应用\n", len(apps))
-	return cfg, nil
-}
\ No newline at end of file
+	generated := []byte(encodeTOML(v))
+	if len(bytes.TrimSpace(original)) == 0 {
+		return generated
+	}
+	edited, err := editTOML(original, v)
+	if err != nil {
+		return generated
+	}
+	// 原地修改的结果必须与重新生成的文件解析出相同的配置
+	got := reflect.New(reflect.TypeOf(v))
+	if err := decodeTOML(edited, got.Interface(), nil, nil); err != nil {
+		return generated
+	}
+	want := reflect.New(reflect.TypeOf(v))
+	if err := decodeTOML(generated, want.Interface(), nil, nil); err != nil {
+		return generated
+	}
+	if !reflect.DeepEqual(got.Interface(), want.Interface()) {
+		return generated
+	}
+	return edited
+}
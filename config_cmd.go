@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// configUsage 是 anyrun config 命令的用法
+const configUsage = "用法: anyrun config edit | history | show <version> | diff <from> [to] | rollback <version>"
+
+// RunConfigCommand 执行 anyrun config 子命令，直接操作配置文件和历史目录。
+// anyrun 服务正在运行时，回滚后的配置会通过文件监视自动加载。
+func RunConfigCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(configUsage)
+	}
+	switch {
+	case args[0] == "edit" && len(args) == 1:
+		return editConfig()
+	case args[0] == "history" && len(args) == 1:
+		versions, err := listConfigVersions()
+		if err != nil {
+			return err
+		}
+		if len(versions) == 0 {
+			fmt.Println("没有历史版本")
+			return nil
+		}
+		fmt.Printf("%-24s %-20s %s\n", "Version", "Time", "Size")
+		for _, v := range versions {
+			fmt.Printf("%-24s %-20s %d\n", v.ID, v.Time.Format("2006-01-02 15:04:05"), v.Size)
+		}
+	case args[0] == "show" && len(args) == 2:
+		data, err := readConfigVersion(findConfigFile(configPath), args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+	case args[0] == "diff" && (len(args) == 2 || len(args) == 3):
+		to := ""
+		if len(args) == 3 {
+			to = args[2]
+		}
+		diff, err := diffConfigVersions(findConfigFile(configPath), args[1], to)
+		if err != nil {
+			return err
+		}
+		if diff == "" {
+			fmt.Println("两个版本内容相同")
+			return nil
+		}
+		fmt.Print(diff)
+	case args[0] == "rollback" && len(args) == 2:
+		if err := rollbackConfig(findConfigFile(configPath), args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("配置已回滚到版本 %s\n", args[1])
+	default:
+		return fmt.Errorf(configUsage)
+	}
+	return nil
+}
+
+// editConfig 用 $VISUAL 或 $EDITOR 编辑配置文件的副本，校验通过后写回。
+// 与 /api/config/save 一样，编辑期间配置文件被其他人修改时不会覆盖，修改保留在临时文件中。
+func editConfig() error {
+	original, revision, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+	// 临时文件使用与配置文件相同的扩展名，便于编辑器识别格式
+	tmp, err := os.CreateTemp("", "anyrun-*"+filepath.Ext(findConfigFile(configPath)))
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	_, err = tmp.Write(original)
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		if err := runEditor(tmpPath); err != nil {
+			return fmt.Errorf("运行编辑器失败: %v（修改保存在 %s）", err, tmpPath)
+		}
+		edited, err := os.ReadFile(tmpPath)
+		if err != nil {
+			return err
+		}
+		if string(edited) == string(original) {
+			os.Remove(tmpPath)
+			fmt.Println("配置没有变化")
+			return nil
+		}
+
+		// 连同 include 引入的应用一起校验
+		cfg, _, err := loadConfigFiles(findConfigFile(configPath), edited)
+		if err == nil {
+			if errs := cfg.Validate(); errs != nil {
+				err = errs
+			}
+		}
+		if err != nil {
+			fmt.Printf("配置有误:\n%v\n", err)
+			fmt.Print("重新编辑? [Y/n] ")
+			answer, _ := reader.ReadString('\n')
+			if answer = strings.ToLower(strings.TrimSpace(answer)); answer == "n" || answer == "no" {
+				return fmt.Errorf("配置未保存，修改保存在 %s", tmpPath)
+			}
+			continue
+		}
+
+		if _, err := writeConfigIfMatch(edited, revision); err == errConfigChanged {
+			current, _, _ := readConfigFile()
+			fmt.Print(unifiedDiff("编辑前", "当前", string(original), string(current)))
+			return fmt.Errorf("配置文件在编辑期间已被修改（见上面的差异），修改保存在 %s，请合并后重试", tmpPath)
+		} else if err != nil {
+			return fmt.Errorf("保存配置失败: %v（修改保存在 %s）", err, tmpPath)
+		}
+		os.Remove(tmpPath)
+		fmt.Println("配置已保存")
+		return nil
+	}
+}
+
+// runEditor 在当前终端中打开编辑器，依次使用 $VISUAL、$EDITOR，默认为 vi（Windows 上为 notepad）
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	// 编辑器变量可以带参数，例如 EDITOR="code --wait"
+	fields, err := splitShellWords(editor)
+	if err != nil || len(fields) == 0 {
+		return fmt.Errorf("无效的编辑器: %s", editor)
+	}
+	cmd := exec.Command(fields[0], append(fields[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// checkDependencies 检查 dependsOn 引用的应用是否存在，以及依赖关系中是否有环
+func checkDependencies(apps []AppConfig) error {
+	byName := map[string]*AppConfig{}
+	for i := range apps {
+		byName[apps[i].Name] = &apps[i]
+	}
+	for _, app := range apps {
+		for _, dep := range app.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return fmt.Errorf("app '%s' depends on unknown app '%s'", app.Name, dep)
+			}
+		}
+	}
+
+	// 深度优先遍历，遇到仍在访问路径上的节点即存在环
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := map[string]int{}
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch marks[name] {
+		case visiting:
+			start := 0
+			for i, n := range path {
+				if n == name {
+					start = i
+				}
+			}
+			return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(path[start:], " -> "), name)
+		case visited:
+			return nil
+		}
+		marks[name] = visiting
+		path = append(path, name)
+		for _, dep := range byName[name].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		marks[name] = visited
+		return nil
+	}
+	for _, app := range apps {
+		if err := visit(app.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startWithDependencies 启动 names 中的应用及其（传递）依赖：应用在所有依赖进入 running 后才启动，
+// 互不依赖的应用并行启动。返回每个被启动应用的错误，names 之外的依赖已在运行时不视为错误。
+func startWithDependencies(apps []AppConfig, names []string) map[string]error {
+	byName := map[string]AppConfig{}
+	for _, app := range apps {
+		byName[app.Name] = app
+	}
+
+	// 收集目标应用及其依赖
+	targets := map[string]bool{}
+	selected := map[string]bool{}
+	var collect func(name string)
+	collect = func(name string) {
+		if selected[name] {
+			return
+		}
+		if _, ok := byName[name]; !ok {
+			return
+		}
+		selected[name] = true
+		for _, dep := range byName[name].DependsOn {
+			collect(dep)
+		}
+	}
+	for _, name := range names {
+		targets[name] = true
+		collect(name)
+	}
+
+	type result struct {
+		ready bool // 应用已进入 running，依赖它的应用可以启动
+		done  chan struct{}
+	}
+	results := map[string]*result{}
+	for name := range selected {
+		results[name] = &result{done: make(chan struct{})}
+	}
+
+	var mu sync.Mutex
+	errs := map[string]error{}
+	for name := range selected {
+		go func(app AppConfig, res *result) {
+			defer close(res.done)
+			var err error
+			for _, dep := range app.DependsOn {
+				depRes := results[dep]
+				<-depRes.done
+				if !depRes.ready && err == nil {
+					err = fmt.Errorf("dependency '%s' is not running", dep)
+				}
+			}
+			if err == nil {
+				err = StartApp(app)
+				res.ready = err == nil
+				if isTransitionError(err) {
+					// 已由其他请求启动，等待其就绪后即可满足依赖
+					res.ready = waitRunning(app)
+					if !targets[app.Name] && res.ready {
+						err = nil
+					}
+				}
+			}
+			if err != nil {
+				mu.Lock()
+				errs[app.Name] = err
+				mu.Unlock()
+			}
+		}(byName[name], results[name])
+	}
+	for _, res := range results {
+		<-res.done
+	}
+	return errs
+}
+
+// stopWithDependents 停止 names 中的应用以及（传递）依赖它们的应用：应用在所有依赖它的应用停止后才停止，
+// 互不依赖的应用并行停止。返回每个被停止应用的错误，names 之外本来就未运行的应用不视为错误。
+func stopWithDependents(apps []AppConfig, names []string) map[string]error {
+	dependents := map[string][]string{}
+	byName := map[string]AppConfig{}
+	for _, app := range apps {
+		byName[app.Name] = app
+		for _, dep := range app.DependsOn {
+			dependents[dep] = append(dependents[dep], app.Name)
+		}
+	}
+
+	targets := map[string]bool{}
+	selected := map[string]bool{}
+	var collect func(name string)
+	collect = func(name string) {
+		if selected[name] {
+			return
+		}
+		if _, ok := byName[name]; !ok {
+			return
+		}
+		selected[name] = true
+		for _, d := range dependents[name] {
+			collect(d)
+		}
+	}
+	for _, name := range names {
+		targets[name] = true
+		collect(name)
+	}
+
+	done := map[string]chan struct{}{}
+	for name := range selected {
+		done[name] = make(chan struct{})
+	}
+
+	var mu sync.Mutex
+	errs := map[string]error{}
+	for name := range selected {
+		go func(app AppConfig) {
+			defer close(done[app.Name])
+			for _, d := range dependents[app.Name] {
+				<-done[d]
+			}
+			err := StopApp(app)
+			if err != nil && (targets[app.Name] || !isTransitionError(err)) {
+				mu.Lock()
+				errs[app.Name] = err
+				mu.Unlock()
+			}
+		}(byName[name])
+	}
+	for _, ch := range done {
+		<-ch
+	}
+	return errs
+}
+
+// waitRunning 等待正在启动的应用结束 starting 状态，返回其是否进入 running
+func waitRunning(app AppConfig) bool {
+	deadline := time.Now().Add(startTimeout(app) + time.Second)
+	for {
+		switch AppState(QueryStatus(app).Status) {
+		case StateRunning:
+			return true
+		case StateStarting:
+			if time.Now().After(deadline) {
+				return false
+			}
+			time.Sleep(200 * time.Millisecond)
+		default:
+			return false
+		}
+	}
+}
+
+// appNames 返回应用名列表
+func appNames(apps []AppConfig) []string {
+	names := make([]string, 0, len(apps))
+	for _, app := range apps {
+		names = append(names, app.Name)
+	}
+	return names
+}
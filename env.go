@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// appWorkDir 返回应用的工作目录：配置了 workDir 时使用它，否则使用 AppPath 所在的目录，
+// AppPath 不是已存在的文件时返回空字符串，即沿用 anyrun 的当前目录
+func appWorkDir(app AppConfig) string {
+	if app.WorkDir != "" {
+		return app.WorkDir
+	}
+	if app.AppPath == "" {
+		return ""
+	}
+	info, err := os.Stat(app.AppPath)
+	if err != nil || info.IsDir() {
+		return ""
+	}
+	dir := filepath.Dir(app.AppPath)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// inheritEnv 返回应用是否继承 anyrun 的环境变量，默认继承
+func inheritEnv(app AppConfig) bool {
+	return app.InheritEnv == nil || *app.InheritEnv
+}
+
+// buildEnv 生成应用的环境变量：继承的环境变量 < envFile < env 表，后者覆盖前者
+func buildEnv(app AppConfig, workDir string) ([]string, error) {
+	vars := map[string]string{}
+	var order []string
+	set := func(key, val string) {
+		if _, ok := vars[key]; !ok {
+			order = append(order, key)
+		}
+		vars[key] = val
+	}
+
+	if inheritEnv(app) {
+		for _, kv := range os.Environ() {
+			if i := strings.Index(kv, "="); i > 0 {
+				set(kv[:i], kv[i+1:])
+			}
+		}
+	}
+	if app.EnvFile != "" {
+		path := app.EnvFile
+		if !filepath.IsAbs(path) && workDir != "" {
+			path = filepath.Join(workDir, path)
+		}
+		fileVars, err := loadEnvFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load env file: %v", err)
+		}
+		for _, kv := range fileVars {
+			set(kv[0], kv[1])
+		}
+	}
+	keys := make([]string, 0, len(app.Env))
+	for key := range app.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		set(key, app.Env[key])
+	}
+
+	env := make([]string, 0, len(order))
+	for _, key := range order {
+		env = append(env, key+"="+vars[key])
+	}
+	return env, nil
+}
+
+// loadEnvFile 按 dotenv 语法读取环境变量文件，按出现顺序返回键值对
+func loadEnvFile(path string) ([][2]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var vars [][2]string
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		i := strings.Index(line, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNo)
+		}
+		key := strings.TrimSpace(line[:i])
+		val, err := parseEnvValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+		}
+		vars = append(vars, [2]string{key, val})
+	}
+	return vars, scanner.Err()
+}
+
+// parseEnvValue 解析 dotenv 中的值：单引号内原样保留，双引号内支持 \n \t \" \\ 转义，
+// 不带引号的值去掉行尾 # 注释
+func parseEnvValue(val string) (string, error) {
+	if val == "" {
+		return "", nil
+	}
+	switch val[0] {
+	case '\'':
+		end := strings.Index(val[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated single quote")
+		}
+		return val[1 : end+1], nil
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(val); i++ {
+			c := val[i]
+			if c == '"' {
+				return b.String(), nil
+			}
+			if c == '\\' && i+1 < len(val) {
+				i++
+				switch val[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case 'r':
+					b.WriteByte('\r')
+				default:
+					b.WriteByte(val[i])
+				}
+				continue
+			}
+			b.WriteByte(c)
+		}
+		return "", fmt.Errorf("unterminated double quote")
+	}
+	if i := strings.Index(val, " #"); i >= 0 {
+		val = val[:i]
+	}
+	return strings.TrimSpace(val), nil
+}
+
+// applyEnv 设置命令的工作目录和环境变量
+func applyEnv(app AppConfig, cmd *exec.Cmd) error {
+	workDir := appWorkDir(app)
+	env, err := buildEnv(app, workDir)
+	if err != nil {
+		return err
+	}
+	cmd.Env = env
+	if workDir == "" {
+		return nil
+	}
+	if info, err := os.Stat(workDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("workDir %q is not a directory", workDir)
+	}
+	cmd.Dir = workDir
+	return nil
+}
+
+// absAppPaths 把相对路径的可执行文件（含路径分隔符时）和存在的 AppPath 转为基于 anyrun
+// 当前目录的绝对路径。AppPath 不存在时可能是 npm 脚本名等，保持原样。
+func absAppPaths(app AppConfig) AppConfig {
+	if app.Execute != "" && !filepath.IsAbs(app.Execute) && filepath.Base(app.Execute) != app.Execute {
+		if abs, err := filepath.Abs(app.Execute); err == nil {
+			app.Execute = abs
+		}
+	}
+	if app.AppPath != "" && !filepath.IsAbs(app.AppPath) {
+		if _, err := os.Stat(app.AppPath); err == nil {
+			if abs, err := filepath.Abs(app.AppPath); err == nil {
+				app.AppPath = abs
+			}
+		}
+	}
+	return app
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvValue(t *testing.T) {
+	tests := []struct {
+		val     string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"plain value", "plain value", false},
+		{"value # comment", "value", false},
+		{"a#b", "a#b", false},
+		{`'single $HOME \n'`, `single $HOME \n`, false},
+		{`"line\nnext\t\"q\""`, "line\nnext\t\"q\"", false},
+		{`"unterminated`, "", true},
+		{`'unterminated`, "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseEnvValue(tt.val)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseEnvValue(%q) = %q, %v; want %q, error %v", tt.val, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	data := "# comment\n\nexport A=1\nB = 'two words'\nC=\"x\\ny\" # trailing\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadEnvFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]string{{"A", "1"}, {"B", "two words"}, {"C", "x\ny"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadEnvFile() = %q, want %q", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte("A=1\nnot a pair\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadEnvFile(path); err == nil || err.Error() != path+":2: expected KEY=VALUE" {
+		t.Errorf("loadEnvFile() error = %v", err)
+	}
+}
+
+func TestBuildCommandRelativeAppPath(t *testing.T) {
+	// 工作目录改变后，相对路径的 AppPath 在参数列表和 shell 命令行中都应为绝对路径
+	if runtime.GOOS == "windows" {
+		t.Skip("shell 模式的命令行在 Windows 上不在 Args 中")
+	}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.MkdirAll("bin", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("bin", "run.sh"), []byte("echo ok\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "bin", "run.sh")
+	for _, shell := range []bool{false, true} {
+		app := AppConfig{Name: "a", Execute: "sh", AppPath: filepath.Join("bin", "run.sh"), Args: AppArgs{Line: "-x"}, Shell: shell}
+		cmd, err := buildCommand(app)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cmd.Dir != filepath.Join(dir, "bin") {
+			t.Errorf("shell=%v: Dir = %q, want %q", shell, cmd.Dir, filepath.Join(dir, "bin"))
+		}
+		if !strings.Contains(strings.Join(cmd.Args, " "), script) {
+			t.Errorf("shell=%v: Args = %q, want the absolute path %s", shell, cmd.Args, script)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// processFingerprint 返回 /proc/<pid>/stat 中的进程启动时间（第 22 项），进程不存在时返回错误
+func processFingerprint(pid int) (string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return "", err
+	}
+	// 进程名可能包含空格和括号，从最后一个 ')' 之后开始解析，此时第 3 项为 state
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	if len(fields) < 20 {
+		return "", fmt.Errorf("unexpected format of /proc/%d/stat", pid)
+	}
+	if fields[0] == "Z" {
+		return "", fmt.Errorf("process %d is a zombie", pid)
+	}
+	return fields[19], nil
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// processFingerprint 通过 ps 返回进程启动时间，进程不存在时返回错误
+func processFingerprint(pid int) (string, error) {
+	if runtime.GOOS == "windows" {
+		return "", fmt.Errorf("process fingerprint is not supported on windows")
+	}
+	out, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return "", err
+	}
+	fingerprint := strings.TrimSpace(string(out))
+	if fingerprint == "" {
+		return "", fmt.Errorf("process %d not found", pid)
+	}
+	return fingerprint, nil
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// 配置文件可以使用 TOML、JSON 或 YAML 格式，按扩展名区分（.json、.yaml/.yml，其余为 TOML）。
+// JSON 和 YAML 的键名与结构体的 json 标签相同（与 toml 标签一致），解析后转换为与 TOML 相同的表结构，
+// 因此 include、profile、模板、未知配置项的提示和校验错误的行号对三种格式的处理都相同。
+// 保存时 TOML 在原文件上只改动发生变化的部分，JSON 和 YAML 重新生成整个文件，保留其中未知的顶层配置项（如 profiles）。
+
+const (
+	formatTOML = "toml"
+	formatJSON = "json"
+	formatYAML = "yaml"
+)
+
+// configFileNames 是查找配置文件时依次尝试的文件名
+var configFileNames = []string{"anyrun.toml", "anyrun.json", "anyrun.yaml", "anyrun.yml"}
+
+// configFormat 根据扩展名返回配置文件的格式
+func configFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return formatJSON
+	case ".yaml", ".yml":
+		return formatYAML
+	}
+	return formatTOML
+}
+
+// parseConfigDocument 按文件格式解析配置内容
+func parseConfigDocument(path string, data []byte) (*tomlTable, error) {
+	switch configFormat(path) {
+	case formatJSON:
+		return parseJSONDocument(data)
+	case formatYAML:
+		return parseYAMLDocument(data)
+	}
+	return parseTOML(data)
+}
+
+// decodeConfigDocument 按文件格式把配置内容解码到 v，lines 和 warn 的含义与 decodeTOML 相同
+func decodeConfigDocument(path string, data []byte, v interface{}, lines map[string]int, warn func(line int, key string)) error {
+	doc, err := parseConfigDocument(path, data)
+	if err != nil {
+		return err
+	}
+	d := &tomlDecoder{data: data, lines: lines, warn: warn}
+	return d.decodeTable(doc, reflect.ValueOf(v).Elem(), "")
+}
+
+// encodeConfigDocument 把 v 写成 JSON 或 YAML 文本。写出的规则与 TOML 相同（省略空的配置项、
+// 与模板相同的配置等），original 中未知的顶层配置项原样保留。
+func encodeConfigDocument(path string, original []byte, v interface{}) []byte {
+	doc, err := parseTOML([]byte(encodeTOML(v)))
+	if err != nil {
+		// encodeTOML 的输出总能解析
+		panic(err)
+	}
+	if old, err := parseConfigDocument(path, original); err == nil {
+		known := map[string]bool{}
+		for _, f := range tomlFields(reflect.TypeOf(v)) {
+			known[f.name] = true
+			known[snakeCase(f.name)] = true
+		}
+		for _, key := range old.keys {
+			if !known[key] {
+				doc.set(key, old.values[key], 0)
+			}
+		}
+	}
+	var b bytes.Buffer
+	if configFormat(path) == formatYAML {
+		writeYAMLTable(&b, doc, 0)
+	} else {
+		writeJSONValue(&b, doc, "")
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// jsonParser 把 JSON 文本解析为 tomlTable，记录每个值在源文件中的位置
+type jsonParser struct {
+	data []byte
+	dec  *json.Decoder
+}
+
+// parseJSONDocument 解析 JSON 格式的配置，顶层必须是对象。值为 null 的键视为没有设置。
+func parseJSONDocument(data []byte) (*tomlTable, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	p := &jsonParser{data: data, dec: dec}
+	val, off, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := val.(*tomlTable)
+	if !ok {
+		return nil, p.errorf(off, "expected a JSON object at the top level")
+	}
+	if _, off, err := p.next(); err != io.EOF {
+		return nil, p.errorf(off, "unexpected data after the top-level object")
+	}
+	return t, nil
+}
+
+// next 读取下一个 token，同时返回它的起始偏移
+func (p *jsonParser) next() (json.Token, int, error) {
+	off := int(p.dec.InputOffset())
+	for off < len(p.data) && strings.IndexByte(" \t\r\n,:", p.data[off]) >= 0 {
+		off++
+	}
+	tok, err := p.dec.Token()
+	if err == io.EOF {
+		return nil, off, err
+	}
+	if err != nil {
+		if syntaxErr, ok := err.(*json.SyntaxError); ok && syntaxErr.Offset > 0 {
+			off = int(syntaxErr.Offset) - 1
+		}
+		msg := strings.TrimPrefix(err.Error(), "json: ")
+		if err == io.ErrUnexpectedEOF {
+			msg = "unexpected end of JSON input"
+		}
+		return nil, off, p.errorf(off, "%s", msg)
+	}
+	return tok, off, nil
+}
+
+// value 读取一个值：对象转换为 tomlTable，元素都是对象的数组转换为 tomlArrayOfTables
+func (p *jsonParser) value() (interface{}, int, error) {
+	tok, off, err := p.next()
+	if err == io.EOF {
+		return nil, off, p.errorf(off, "unexpected end of JSON input")
+	}
+	if err != nil {
+		return nil, off, err
+	}
+	switch x := tok.(type) {
+	case json.Delim:
+		if x == '{' {
+			t := newTOMLTable()
+			t.start = off
+			for p.dec.More() {
+				tok, keyOff, err := p.next()
+				if err != nil {
+					return nil, keyOff, err
+				}
+				key := tok.(string)
+				val, valOff, err := p.value()
+				if err != nil {
+					return nil, valOff, err
+				}
+				if val == nil {
+					continue
+				}
+				t.set(key, val, valOff)
+				t.keyPos[key] = keyOff
+				t.end[key] = int(p.dec.InputOffset())
+			}
+			_, _, err := p.next()
+			return t, off, err
+		}
+		var arr []interface{}
+		for p.dec.More() {
+			val, valOff, err := p.value()
+			if err != nil {
+				return nil, valOff, err
+			}
+			if val == nil {
+				return nil, valOff, p.errorf(valOff, "null is not allowed in arrays")
+			}
+			arr = append(arr, val)
+		}
+		if _, _, err := p.next(); err != nil {
+			return nil, off, err
+		}
+		return tableArray(arr), off, nil
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i, off, nil
+		}
+		f, err := x.Float64()
+		if err != nil {
+			return nil, off, p.errorf(off, "invalid number %s", x)
+		}
+		return f, off, nil
+	default:
+		// string、bool 或 nil
+		return x, off, nil
+	}
+}
+
+func (p *jsonParser) errorf(off int, format string, args ...interface{}) error {
+	d := &tomlDecoder{data: p.data}
+	return d.errorf(off, format, args...)
+}
+
+// tableArray 把元素都是表的数组转换为表数组，与 TOML 的 [[apps]] 相同
+func tableArray(arr []interface{}) interface{} {
+	if len(arr) == 0 {
+		return arr
+	}
+	tables := make([]*tomlTable, len(arr))
+	for i, item := range arr {
+		t, ok := item.(*tomlTable)
+		if !ok {
+			return arr
+		}
+		tables[i] = t
+	}
+	return &tomlArrayOfTables{tables: tables}
+}
+
+// writeJSONValue 把解析后的值写成缩进两个空格的 JSON，保留键的顺序。只包含标量的数组写在一行内。
+func writeJSONValue(b *bytes.Buffer, val interface{}, indent string) {
+	switch x := val.(type) {
+	case *tomlTable:
+		if len(x.keys) == 0 {
+			b.WriteString("{}")
+			return
+		}
+		b.WriteString("{\n")
+		for i, key := range x.keys {
+			b.WriteString(indent + "  ")
+			writeJSONScalar(b, key)
+			b.WriteString(": ")
+			writeJSONValue(b, x.values[key], indent+"  ")
+			if i < len(x.keys)-1 {
+				b.WriteByte(',')
+			}
+			b.WriteByte('\n')
+		}
+		b.WriteString(indent + "}")
+	case *tomlArrayOfTables:
+		items := make([]interface{}, len(x.tables))
+		for i, t := range x.tables {
+			items[i] = t
+		}
+		writeJSONValue(b, items, indent)
+	case []interface{}:
+		if len(x) == 0 {
+			b.WriteString("[]")
+			return
+		}
+		if _, ok := tableArray(x).(*tomlArrayOfTables); !ok {
+			b.WriteByte('[')
+			for i, item := range x {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				writeJSONValue(b, item, indent)
+			}
+			b.WriteByte(']')
+			return
+		}
+		b.WriteString("[\n")
+		for i, item := range x {
+			b.WriteString(indent + "  ")
+			writeJSONValue(b, item, indent+"  ")
+			if i < len(x)-1 {
+				b.WriteByte(',')
+			}
+			b.WriteByte('\n')
+		}
+		b.WriteString(indent + "]")
+	case tomlDatetime:
+		writeJSONScalar(b, string(x))
+	default:
+		writeJSONScalar(b, x)
+	}
+}
+
+// writeJSONScalar 写出字符串、数字或布尔值，字符串中的 <、>、& 不转义
+func writeJSONScalar(b *bytes.Buffer, v interface{}) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		// NaN 和无穷大无法用 JSON 表示
+		b.WriteString("null")
+		return
+	}
+	b.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
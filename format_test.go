@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAMLDocument(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		toml string // 等价的 TOML
+	}{
+		{"scalars", "s: text\nq: 'it''s'\ndq: \"a\\tb\"\ni: 42\nneg: -7\nf: 1.5\nb: true\nn: ~\nstr_num: \"80\"", "s = \"text\"\nq = \"it's\"\ndq = \"a\\tb\"\ni = 42\nneg = -7\nf = 1.5\nb = true\nstr_num = \"80\""},
+		{"comments", "# 注释\na: 1 # 行尾注释\nb: 'x # y'", "a = 1\nb = \"x # y\""},
+		{"nested mapping", "logs:\n  dir: /var/log\n  maxSize: 10", "[logs]\ndir = \"/var/log\"\nmaxSize = 10"},
+		{"sequence of scalars", "include:\n  - a.yaml\n  - b.yaml", "include = [\"a.yaml\", \"b.yaml\"]"},
+		{"flow collections", "args: [-p, \"80\"]\nenv: {A: 1, B: x}", "args = [\"-p\", \"80\"]\nenv = { A = 1, B = \"x\" }"},
+		{"sequence of mappings", "apps:\n  - name: web\n    port: 80\n    env:\n      MODE: prod\n  - name: worker", "[[apps]]\nname = \"web\"\nport = 80\n[apps.env]\nMODE = \"prod\"\n[[apps]]\nname = \"worker\""},
+		{"sequence at parent indent", "apps:\n- name: a\nuiPort: 1", "uiPort = 1\n[[apps]]\nname = \"a\""},
+		{"literal block", "cmd: |\n  line1\n  line2\n", "cmd = \"line1\\nline2\\n\""},
+		{"folded block strip", "cmd: >-\n  a\n  b\n", "cmd = \"a b\""},
+		{"empty collections", "a: []\nb: {}", "a = []\nb = {}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAMLDocument([]byte(tt.yaml))
+			if err != nil {
+				t.Fatalf("parseYAMLDocument(%q): %v", tt.yaml, err)
+			}
+			want, err := parseTOML([]byte(tt.toml))
+			if err != nil {
+				t.Fatalf("parseTOML(%q): %v", tt.toml, err)
+			}
+			if !reflect.DeepEqual(plainTOMLValue(got), plainTOMLValue(want)) {
+				t.Errorf("parseYAMLDocument(%q) = %#v, want %#v", tt.yaml, plainTOMLValue(got), plainTOMLValue(want))
+			}
+		})
+	}
+}
+
+func TestParseJSONDocument(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		toml string
+	}{
+		{"scalars", `{"s": "a<b>&c", "i": 42, "f": 1.5, "b": false}`, "s = \"a<b>&c\"\ni = 42\nf = 1.5\nb = false"},
+		{"null is absent", `{"a": null, "b": 1}`, "b = 1"},
+		{"nested object", `{"logs": {"dir": "x"}}`, "[logs]\ndir = \"x\""},
+		{"array of objects", `{"apps": [{"name": "a", "env": {"K": "v"}}, {"name": "b"}]}`, "[[apps]]\nname = \"a\"\n[apps.env]\nK = \"v\"\n[[apps]]\nname = \"b\""},
+		{"array of strings", `{"args": ["-p", "80"]}`, "args = [\"-p\", \"80\"]"},
+		{"empty array", `{"apps": []}`, "apps = []"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseJSONDocument([]byte(tt.json))
+			if err != nil {
+				t.Fatalf("parseJSONDocument(%q): %v", tt.json, err)
+			}
+			want, err := parseTOML([]byte(tt.toml))
+			if err != nil {
+				t.Fatalf("parseTOML(%q): %v", tt.toml, err)
+			}
+			if !reflect.DeepEqual(plainTOMLValue(got), plainTOMLValue(want)) {
+				t.Errorf("parseJSONDocument(%q) = %#v, want %#v", tt.json, plainTOMLValue(got), plainTOMLValue(want))
+			}
+		})
+	}
+}
+
+func TestParseConfigDocumentErrors(t *testing.T) {
+	tests := []struct {
+		path      string
+		input     string
+		line, col int
+		msg       string
+	}{
+		{"a.yaml", "a: 1\n\tb: 2", 2, 1, "tabs are not allowed"},
+		{"a.yaml", "a: 1\na: 2", 2, 1, "duplicate key 'a'"},
+		{"a.yaml", "a: &x 1", 1, 4, "anchors, aliases and tags are not supported"},
+		{"a.yml", "a: 1\n---\nb: 2", 2, 1, "multiple YAML documents"},
+		{"a.yaml", "a: [1, 2", 1, 9, "expected ',' or ']'"},
+		{"a.yaml", "a:\n  - 1\n  b: 2", 3, 3, "unexpected indentation"},
+		{"a.yaml", `a: "x`, 1, 4, "unterminated string"},
+		{"a.json", "[]", 1, 1, "expected a JSON object at the top level"},
+		{"a.json", `{"a": [1, null]}`, 1, 11, "null is not allowed in arrays"},
+		{"a.json", `{"a": 1} x`, 1, 10, "unexpected data after the top-level object"},
+		{"a.json", "{\n  \"a\": tru\n}", 2, 11, "invalid character"},
+		{"a.json", `{"a": 1`, 1, 7, "unexpected end of JSON input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.msg, func(t *testing.T) {
+			_, err := parseConfigDocument(tt.path, []byte(tt.input))
+			var tomlErr *TOMLError
+			if !errors.As(err, &tomlErr) {
+				t.Fatalf("parseConfigDocument(%q) error = %v, want *TOMLError", tt.input, err)
+			}
+			if tomlErr.Line != tt.line || tomlErr.Col != tt.col || !strings.Contains(tomlErr.Msg, tt.msg) {
+				t.Errorf("parseConfigDocument(%q) error = %v, want line %d, column %d: %s", tt.input, err, tt.line, tt.col, tt.msg)
+			}
+		})
+	}
+}
+
+func TestDecodeConfigDocumentFormats(t *testing.T) {
+	want := Config{
+		UIPort: 8080,
+		Apps: []AppConfig{{
+			Name:    "web",
+			Execute: "/usr/bin/web",
+			Args:    AppArgs{List: []string{"-p", "80"}, Array: true},
+			Port:    80,
+			Env:     map[string]string{"MODE": "prod"},
+		}},
+	}
+	docs := map[string]string{
+		"anyrun.toml": "uiPort = 8080\n[[apps]]\nname = \"web\"\nexecute = \"/usr/bin/web\"\nargs = [\"-p\", \"80\"]\nport = 80\n[apps.env]\nMODE = \"prod\"\n",
+		"anyrun.json": `{"uiPort": 8080, "apps": [{"name": "web", "execute": "/usr/bin/web", "args": ["-p", "80"], "port": 80, "env": {"MODE": "prod"}}]}`,
+		"anyrun.yaml": "uiPort: 8080\napps:\n  - name: web\n    execute: /usr/bin/web\n    args: [-p, \"80\"]\n    port: 80\n    env:\n      MODE: prod\n",
+	}
+	for path, doc := range docs {
+		t.Run(path, func(t *testing.T) {
+			var got Config
+			lines := map[string]int{}
+			if err := decodeConfigDocument(path, []byte(doc), &got, lines, nil); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("decodeConfigDocument() = %#v, want %#v", got, want)
+			}
+			if lines["apps[0].port"] == 0 {
+				t.Errorf("line of apps[0].port not recorded: %v", lines)
+			}
+		})
+	}
+}
+
+func TestEncodeConfigDocumentRoundTrip(t *testing.T) {
+	cfg := Config{
+		UIPort: 8080,
+		Apps: []AppConfig{{
+			Name:    "web",
+			Execute: "/usr/bin/web",
+			Args:    AppArgs{Line: `--title "a: b" # not a comment`},
+			Port:    80,
+			Env:     map[string]string{"EMPTY": "", "NUM": "007", "YES": "yes", "MULTI": "a\nb"},
+		}},
+		User: &UserConfig{Username: "admin"},
+	}
+	for _, path := range []string{"anyrun.json", "anyrun.yaml"} {
+		t.Run(path, func(t *testing.T) {
+			original := "profiles:\n  prod:\n    uiPort: 9090\n"
+			if configFormat(path) == formatJSON {
+				original = `{"profiles": {"prod": {"uiPort": 9090}}}`
+			}
+			data := encodeConfigDocument(path, []byte(original), cfg)
+			var got Config
+			if err := decodeConfigDocument(path, data, &got, nil, nil); err != nil {
+				t.Fatalf("decode: %v\n%s", err, data)
+			}
+			if !reflect.DeepEqual(got, cfg) {
+				t.Errorf("round trip mismatch\n got: %#v\nwant: %#v\n%s", got, cfg, data)
+			}
+			doc, err := parseConfigDocument(path, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := doc.values["profiles"]; !ok {
+				t.Errorf("unknown top-level key profiles was not preserved:\n%s", data)
+			}
+		})
+	}
+}
+
+func TestUpdateConfigDocumentKeepsUnchangedFile(t *testing.T) {
+	docs := map[string]string{
+		"conf.d/a.yaml": "# 注释\napps:\n  - name: a # 应用\n    execute: a\n",
+		"conf.d/a.json": "{\"apps\": [{\"name\": \"a\", \"execute\": \"a\"}]}\n",
+	}
+	for path, doc := range docs {
+		var inc includeConfig
+		if err := decodeConfigDocument(path, []byte(doc), &inc, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := updateConfigDocument(path, []byte(doc), inc); string(got) != doc {
+			t.Errorf("updateConfigDocument(%s) rewrote an unchanged file:\n%s", path, got)
+		}
+		inc.Apps[0].Port = 80
+		if got := updateConfigDocument(path, []byte(doc), inc); !strings.Contains(string(got), "port") {
+			t.Errorf("updateConfigDocument(%s) did not write the change:\n%s", path, got)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// 健康状态
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// 健康检查参数的默认值
+const (
+	defaultHealthInterval         = 10
+	defaultHealthTimeout          = 3
+	defaultHealthFailureThreshold = 3
+	defaultHealthSuccessThreshold = 1
+)
+
+// probeHealth 执行一次健康检查，返回 nil 表示健康
+func probeHealth(app AppConfig, hc *HealthCheck) error {
+	timeout := hc.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	switch hc.Type {
+	case "http":
+		url := hc.URL
+		if url == "" {
+			url = fmt.Sprintf("http://127.0.0.1:%d/", app.Port)
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if hc.ExpectStatus != 0 {
+			if resp.StatusCode != hc.ExpectStatus {
+				return fmt.Errorf("unexpected status %d", resp.StatusCode)
+			}
+		} else if resp.StatusCode >= 400 {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		if hc.ExpectBody != "" {
+			body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+			if err != nil {
+				return err
+			}
+			if !strings.Contains(string(body), hc.ExpectBody) {
+				return fmt.Errorf("response body does not contain %q", hc.ExpectBody)
+			}
+		}
+		return nil
+	case "tcp":
+		addr := hc.Address
+		if addr == "" {
+			addr = fmt.Sprintf("127.0.0.1:%d", app.Port)
+		}
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+		return nil
+	case "exec":
+		// 与 args 相同，命令按 shell 规则拆分，支持带引号的参数
+		parts, err := splitShellWords(hc.Command)
+		if err != nil {
+			return fmt.Errorf("invalid healthcheck command: %v", err)
+		}
+		if len(parts) == 0 {
+			return fmt.Errorf("no healthcheck command specified")
+		}
+		return exec.CommandContext(ctx, parts[0], parts[1:]...).Run()
+	}
+	return fmt.Errorf("unknown healthcheck type %q", hc.Type)
+}
+
+// healthLoop 周期性检查应用健康状态，状态变化时通过 report 通知状态机，直到进程退出
+func healthLoop(app AppConfig, done chan struct{}, report func(health string)) {
+	hc := app.Healthcheck
+	interval := hc.Interval
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+	failureThreshold := hc.FailureThreshold
+	if failureThreshold <= 0 {
+		failureThreshold = defaultHealthFailureThreshold
+	}
+	successThreshold := hc.SuccessThreshold
+	if successThreshold <= 0 {
+		successThreshold = defaultHealthSuccessThreshold
+	}
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	successes, failures := 0, 0
+	health := HealthStarting
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		err := probeHealth(app, hc)
+		if err == nil {
+			successes++
+			failures = 0
+			if successes >= successThreshold && health != HealthHealthy {
+				fmt.Printf("应用 %s 健康检查通过\n", app.Name)
+				health = HealthHealthy
+				report(health)
+			}
+		} else {
+			failures++
+			successes = 0
+			if failures >= failureThreshold && health != HealthUnhealthy {
+				fmt.Printf("应用 %s 健康检查失败: %v\n", app.Name, err)
+				health = HealthUnhealthy
+				report(health)
+			}
+		}
+	}
+}
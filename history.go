@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// historyDir 保存配置文件被覆盖前的历史版本，文件名为保存时间
+var historyDir = filepath.Join(stateDir, "history")
+
+// maxHistory 是保留的历史版本数量上限，超出时删除最旧的版本
+const maxHistory = 50
+
+// currentVersion 表示当前的配置文件，可用于 diff
+const currentVersion = "current"
+
+// ConfigVersion 是配置文件的一个历史版本
+type ConfigVersion struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"`
+}
+
+// writeFileAtomic 先写入同目录下的临时文件并 fsync，再重命名覆盖目标文件，
+// 写入过程中崩溃不会留下不完整的文件
+func writeFileAtomic(path string, data []byte) error {
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// 同步目录，保证重命名落盘；Windows 不支持打开目录同步，忽略错误
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// commitConfigFiles 把组成配置的文件 files（第一个为主配置文件）原子地写为 written 中对应的内容，
+// 只写入内容发生变化的文件。有文件变化时先把所有文件的旧内容保存为一个历史版本，
+// 回滚到该版本时主配置文件和 include 引入的文件一起恢复。
+func commitConfigFiles(files, written []configFile) error {
+	changed := false
+	for i := range files {
+		if !bytes.Equal(files[i].data, written[i].data) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	// 主配置文件还不存在时没有可以保存的旧版本
+	if _, err := os.Stat(files[0].path); err == nil {
+		if err := saveConfigVersion(files); err != nil {
+			return fmt.Errorf("failed to back up config: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	for i, f := range written {
+		if !bytes.Equal(files[i].data, f.data) {
+			if err := writeFileAtomic(f.path, f.data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// includeSnapshot 是历史版本中保存的一个 include 文件
+type includeSnapshot struct {
+	Path string `json:"path"`
+	Data string `json:"data"`
+}
+
+// saveConfigVersion 把组成配置的文件的内容保存为新的历史版本，并清理超出数量上限的旧版本。
+// 主配置文件保存为 <id> 加上配置文件的扩展名（如 .toml、.yaml），include 引入的文件保存在 <id>.includes 中。
+func saveConfigVersion(files []configFile) error {
+	if err := os.MkdirAll(historyDir, 0755); err != nil {
+		return err
+	}
+	base := time.Now().Format("20060102-150405.000")
+	id := base
+	for i := 1; ; i++ {
+		if versionFile(id) == "" {
+			break
+		}
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+	if len(files) > 1 {
+		includes := make([]includeSnapshot, len(files)-1)
+		for i, f := range files[1:] {
+			includes[i] = includeSnapshot{Path: f.path, Data: string(f.data)}
+		}
+		data, err := json.MarshalIndent(includes, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(includesFile(id), data); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(filepath.Join(historyDir, id+versionExt(files[0].path)), files[0].data); err != nil {
+		return err
+	}
+
+	versions, err := listConfigVersions()
+	if err != nil {
+		return err
+	}
+	for _, v := range versions[min(len(versions), maxHistory):] {
+		os.Remove(versionFile(v.ID))
+		os.Remove(includesFile(v.ID))
+	}
+	return nil
+}
+
+// versionExts 是历史版本文件的扩展名，与保存时的配置文件相同
+var versionExts = []string{".toml", ".json", ".yaml", ".yml"}
+
+// versionExt 返回配置文件 path 的历史版本使用的扩展名，不是 JSON 或 YAML 的配置文件按 TOML 处理
+func versionExt(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if slices.Contains(versionExts, ext) {
+		return ext
+	}
+	return ".toml"
+}
+
+// versionFile 返回历史版本的文件路径，版本不存在时返回空字符串
+func versionFile(id string) string {
+	for _, ext := range versionExts {
+		p := filepath.Join(historyDir, id+ext)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+// includesFile 返回历史版本中 include 文件内容的保存路径
+func includesFile(id string) string {
+	return filepath.Join(historyDir, id+".includes")
+}
+
+// listConfigVersions 返回所有历史版本，最新的在前
+func listConfigVersions() ([]ConfigVersion, error) {
+	entries, err := os.ReadDir(historyDir)
+	if os.IsNotExist(err) {
+		return []ConfigVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions := []ConfigVersion{}
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if entry.IsDir() || !slices.Contains(versionExts, ext) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		versions = append(versions, ConfigVersion{
+			ID:   strings.TrimSuffix(name, ext),
+			Time: info.ModTime(),
+			Size: info.Size(),
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].ID > versions[j].ID
+	})
+	return versions, nil
+}
+
+// readConfigVersion 读取历史版本的内容，id 为 current 时读取当前配置文件
+func readConfigVersion(path, id string) ([]byte, error) {
+	if id == currentVersion {
+		return os.ReadFile(path)
+	}
+	if id == "" || filepath.Base(id) != id || strings.HasPrefix(id, ".") {
+		return nil, fmt.Errorf("invalid version '%s'", id)
+	}
+	file := versionFile(id)
+	if file == "" {
+		return nil, fmt.Errorf("version '%s' not found", id)
+	}
+	return os.ReadFile(file)
+}
+
+// readVersionIncludes 读取历史版本中保存的 include 文件，ok 为 false 表示该版本没有记录 include 文件
+// （配置没有 include 文件，或版本由不记录 include 文件的旧版本 anyrun 保存）
+func readVersionIncludes(id string) (files []configFile, ok bool, err error) {
+	data, err := os.ReadFile(includesFile(id))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var includes []includeSnapshot
+	if err := json.Unmarshal(data, &includes); err != nil {
+		return nil, false, fmt.Errorf("version '%s': invalid include snapshot: %v", id, err)
+	}
+	for _, inc := range includes {
+		files = append(files, configFile{path: inc.Path, data: []byte(inc.Data)})
+	}
+	return files, true, nil
+}
+
+// configVersionFiles 返回一个版本中组成配置的文件，第一个为主配置文件。id 为 current 时读取当前的文件。
+// ok 为 false 表示不知道该版本的 include 文件。
+func configVersionFiles(path, id string) (files []configFile, ok bool, err error) {
+	data, err := readConfigVersion(path, id)
+	if err != nil {
+		return nil, false, err
+	}
+	if id == currentVersion {
+		_, files, _ := loadConfigFiles(path, data)
+		return files, true, nil
+	}
+	includes, ok, err := readVersionIncludes(id)
+	if err != nil {
+		return nil, false, err
+	}
+	return append([]configFile{{path: path, data: data}}, includes...), ok, nil
+}
+
+// diffConfigVersions 返回两个版本之间的 unified diff，to 为空时与当前配置比较。
+// 两个版本都记录了 include 文件时，同时比较每个 include 文件（只在一侧存在的文件按空文件比较）。
+func diffConfigVersions(path, from, to string) (string, error) {
+	if to == "" {
+		to = currentVersion
+	}
+	a, aOK, err := configVersionFiles(path, from)
+	if err != nil {
+		return "", err
+	}
+	b, bOK, err := configVersionFiles(path, to)
+	if err != nil {
+		return "", err
+	}
+	diff := unifiedDiff(from, to, string(a[0].data), string(b[0].data))
+	if !aOK || !bOK {
+		return diff, nil
+	}
+	var paths []string
+	aFiles, bFiles := map[string][]byte{}, map[string][]byte{}
+	for _, f := range a[1:] {
+		aFiles[f.path] = f.data
+		paths = append(paths, f.path)
+	}
+	for _, f := range b[1:] {
+		bFiles[f.path] = f.data
+		if _, ok := aFiles[f.path]; !ok {
+			paths = append(paths, f.path)
+		}
+	}
+	for _, p := range paths {
+		diff += unifiedDiff(from+" "+p, to+" "+p, string(aFiles[p]), string(bFiles[p]))
+	}
+	return diff, nil
+}
+
+// rollbackConfig 把配置恢复为指定的历史版本：主配置文件和版本中记录的 include 文件一起恢复，
+// 恢复前的配置同样会保存为历史版本。历史版本无法解析或校验失败时不做修改。
+func rollbackConfig(path, id string) error {
+	versionFiles, _, err := configVersionFiles(path, id)
+	if err != nil {
+		return err
+	}
+	includes := map[string][]byte{}
+	for _, f := range versionFiles[1:] {
+		includes[f.path] = f.data
+	}
+	cfg, _, err := loadConfigSnapshot(path, versionFiles[0].data, includes)
+	if err != nil {
+		return fmt.Errorf("version '%s' is not a valid config: %v", id, err)
+	}
+	if errs := cfg.Validate(); errs != nil {
+		return fmt.Errorf("version '%s' is not a valid config:\n%v", id, errs)
+	}
+
+	// 当前组成配置的文件，加上版本中记录但现在已不存在或不再引入的 include 文件
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	_, files, _ := loadConfigFiles(path, data)
+	current := map[string]bool{}
+	for _, f := range files {
+		current[f.path] = true
+	}
+	for _, f := range versionFiles[1:] {
+		if !current[f.path] {
+			data, err := os.ReadFile(f.path)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			files = append(files, configFile{path: f.path, data: data})
+		}
+	}
+	written := make([]configFile, len(files))
+	for i, f := range files {
+		written[i] = f
+		if data, ok := includes[f.path]; ok {
+			written[i].data = data
+		}
+	}
+	written[0].data = versionFiles[0].data
+	return commitConfigFiles(files, written)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// systemConfigDir 是系统级配置目录，使用其中的配置文件时自动加载 conf.d 中的 *.toml、*.json、*.yaml 和 *.yml
+const systemConfigDir = "/etc/anyrun"
+
+// includeConfig 是 include 引入的文件的内容，只能定义应用
+type includeConfig struct {
+	Apps []AppConfig `json:"apps" toml:"apps"`
+}
+
+// configFile 是组成配置的一个文件
+type configFile struct {
+	path string
+	data []byte
+}
+
+// includePatterns 返回主配置文件引入的文件模式（绝对路径或相对于当前目录的路径）
+func includePatterns(path string, include []string) []string {
+	dir := filepath.Dir(path)
+	var patterns []string
+	for _, p := range include {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		patterns = append(patterns, filepath.Clean(p))
+	}
+	if abs, err := filepath.Abs(dir); err == nil && abs == systemConfigDir {
+		for _, ext := range []string{"toml", "json", "yaml", "yml"} {
+			patterns = append(patterns, filepath.Join(systemConfigDir, "conf.d", "*."+ext))
+		}
+	}
+	return patterns
+}
+
+// includeFiles 展开 include 模式，返回排序、去重后的文件列表，不包括主配置文件本身。
+// 不含通配符的模式对应的文件必须存在。
+func includeFiles(path string, include []string) ([]string, error) {
+	seen := map[string]bool{}
+	if abs, err := filepath.Abs(path); err == nil {
+		seen[abs] = true
+	}
+	var files []string
+	for _, pattern := range includePatterns(path, include) {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern '%s': %v", pattern, err)
+		}
+		if len(matches) == 0 && !hasGlobMeta(pattern) {
+			return nil, fmt.Errorf("include file '%s' not found", pattern)
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			if info, err := os.Stat(m); err != nil || info.IsDir() {
+				continue
+			}
+			abs, err := filepath.Abs(m)
+			if err != nil || seen[abs] {
+				continue
+			}
+			seen[abs] = true
+			files = append(files, m)
+		}
+	}
+	return files, nil
+}
+
+// hasGlobMeta 判断路径中是否包含通配符
+func hasGlobMeta(pattern string) bool {
+	for _, c := range pattern {
+		if c == '*' || c == '?' || c == '[' {
+			return true
+		}
+	}
+	return false
+}
+
+// loadConfigFiles 解析主配置文件的内容 data，并加载 include 引入的文件，把其中的应用按文件顺序合并到配置中。
+// 返回组成配置的文件，第一个为主配置文件；出错时仍返回已经读取的文件。
+func loadConfigFiles(path string, data []byte) (Config, []configFile, error) {
+	return loadConfigSnapshot(path, data, nil)
+}
+
+// loadConfigSnapshot 与 loadConfigFiles 相同，但 include 文件优先使用 includes 中的内容（回滚时校验历史版本）
+func loadConfigSnapshot(path string, data []byte, includes map[string][]byte) (Config, []configFile, error) {
+	files := []configFile{{path: path, data: data}}
+	cfg, err := parseConfig(path, data)
+	if err != nil {
+		return cfg, files, err
+	}
+	paths, err := includeFiles(path, cfg.Include)
+	if err != nil {
+		return cfg, files, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, p := range paths {
+		data, ok := includes[p]
+		if !ok {
+			if data, err = os.ReadFile(p); err != nil {
+				return cfg, files, err
+			}
+		}
+		files = append(files, configFile{path: p, data: data})
+		var inc includeConfig
+		lines := map[string]int{}
+		err = decodeConfigDocument(p, data, &inc, lines, func(line int, key string) {
+			fmt.Printf("未知配置项在 %s 第%d行: %s（include 文件中只能定义 [[apps]]）\n", p, line, key)
+		})
+		if err == nil {
+			// include 文件中的应用可以引用主配置文件中的模板
+			err = expandTemplates(inc.Apps, cfg.Templates, p, data)
+		}
+		if err != nil {
+			return cfg, files, fmt.Errorf("%s: %v", p, err)
+		}
+		cfg.appendApps(inc.Apps, lines, p)
+	}
+	return cfg, files, nil
+}
+
+// appFiles 返回来自 include 文件的应用名称与文件路径的对应关系
+func (c Config) appFiles() map[string]string {
+	files := map[string]string{}
+	for i, app := range c.Apps {
+		if file, ok := c.files[fmt.Sprintf("apps[%d]", i)]; ok {
+			files[app.Name] = file
+		}
+	}
+	return files
+}
+
+// writeConfigFiles 把配置写回组成它的各个文件，current 是从这些文件读取的配置：应用写回原来所在的
+// include 文件，其余的（包括新增的应用）写入主配置文件。每个文件只改动发生变化的部分，
+// 引用了模板的应用只写出与模板不同的配置，写入前把所有文件的旧内容保存为一个历史版本。返回写入后的文件内容。
+func writeConfigFiles(files []configFile, cfg Config, current Config) ([]configFile, error) {
+	appFiles := current.appFiles()
+	cfg = cfg.withTemplateDefaults(current.Templates)
+	main := cfg
+	main.Apps = []AppConfig{}
+	included := map[string][]AppConfig{}
+	for _, app := range cfg.Apps {
+		if file, ok := appFiles[app.Name]; ok {
+			included[file] = append(included[file], app)
+		} else {
+			main.Apps = append(main.Apps, app)
+		}
+	}
+
+	written := make([]configFile, len(files))
+	for i, f := range files {
+		if i == 0 {
+			written[i] = configFile{path: f.path, data: updateConfigDocument(f.path, f.data, main)}
+			continue
+		}
+		written[i] = configFile{path: f.path, data: updateConfigDocument(f.path, f.data, includeConfig{Apps: included[f.path]})}
+	}
+	if err := commitConfigFiles(files, written); err != nil {
+		return nil, err
+	}
+	return written, nil
+}
+
+// configFilesRevision 返回整个配置的版本号：只有主配置文件时为其内容哈希，否则为所有文件路径和内容的哈希
+func configFilesRevision(files []configFile) string {
+	if len(files) == 1 {
+		return configRevision(files[0].data)
+	}
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\x00%d\x00", f.path, len(f.data))
+		h.Write(f.data)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// configWatchPatterns 返回需要监视的文件模式：主配置文件、profile 文件及引入的文件
+func configWatchPatterns(path string) []string {
+	patterns := []string{path}
+	if configProfile != "" {
+		patterns = append(patterns, profileFile(path, configProfile))
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		var cfg Config
+		if decodeConfigDocument(path, data, &cfg, nil, nil) == nil {
+			patterns = append(patterns, includePatterns(path, cfg.Include)...)
+		}
+	}
+	return patterns
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// interpolatedField 是应用配置中支持 ${...} 引用的一个字段
+type interpolatedField struct {
+	path  string           // 字段路径，例如 env.DB_PASSWORD
+	value string           // 字段的值
+	set   func(val string) // 修改字段的值
+}
+
+// interpolatedFields 返回应用中支持 ${...} 引用的字段：execute、appPath、args、workDir、envFile、
+// env 的值以及健康检查的 url、address、command 和 expectBody
+func interpolatedFields(app *AppConfig) []interpolatedField {
+	var fields []interpolatedField
+	add := func(path string, p *string) {
+		fields = append(fields, interpolatedField{path, *p, func(val string) { *p = val }})
+	}
+	add("execute", &app.Execute)
+	add("appPath", &app.AppPath)
+	if app.Args.Array {
+		for i := range app.Args.List {
+			add(fmt.Sprintf("args[%d]", i), &app.Args.List[i])
+		}
+	} else {
+		add("args", &app.Args.Line)
+	}
+	add("workDir", &app.WorkDir)
+	add("envFile", &app.EnvFile)
+	keys := make([]string, 0, len(app.Env))
+	for key := range app.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fields = append(fields, interpolatedField{"env." + key, app.Env[key], func(val string) { app.Env[key] = val }})
+	}
+	if hc := app.Healthcheck; hc != nil {
+		add("healthcheck.url", &hc.URL)
+		add("healthcheck.address", &hc.Address)
+		add("healthcheck.command", &hc.Command)
+		add("healthcheck.expectBody", &hc.ExpectBody)
+	}
+	return fields
+}
+
+// resolveApp 返回展开了 ${...} 引用的应用配置副本，在启动进程时调用，
+// 因此配置接口和 -printcfg 输出的仍是原始的引用，不会暴露环境变量和密钥文件的内容
+func resolveApp(app AppConfig) (AppConfig, error) {
+	// 复制引用类型的字段，避免修改原配置
+	app = cloneApp(app)
+	for _, f := range interpolatedFields(&app) {
+		val, err := interpolate(f.value)
+		if err != nil {
+			return app, fmt.Errorf("%s: %v", f.path, err)
+		}
+		f.set(val)
+	}
+	return app, nil
+}
+
+// interpolate 展开字符串中的引用：${VAR} 为环境变量，${VAR:-default} 在变量未设置或为空时使用默认值，
+// ${file:/path} 为文件内容（去掉末尾的换行），$${ 表示字面的 ${
+func interpolate(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+		end := strings.IndexByte(s[i+2:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated reference '%s'", s[i:])
+		}
+		val, err := resolveReference(s[i+2 : i+2+end])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(val)
+		s = s[i+2+end+1:]
+	}
+}
+
+// resolveReference 解析 ${...} 中的内容，错误信息中不包含变量或文件的值
+func resolveReference(ref string) (string, error) {
+	if path, ok := strings.CutPrefix(ref, "file:"); ok {
+		if path == "" {
+			return "", fmt.Errorf("missing file path in '${%s}'", ref)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if pathErr, ok := err.(*os.PathError); ok {
+				err = pathErr.Err
+			}
+			return "", fmt.Errorf("cannot read file '%s' referenced by '${%s}': %v", path, ref, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	name, def, hasDefault := strings.Cut(ref, ":-")
+	if !isEnvName(name) {
+		return "", fmt.Errorf("invalid reference '${%s}' (expected ${VAR}, ${VAR:-default} or ${file:/path})", ref)
+	}
+	val, ok := os.LookupEnv(name)
+	if ok && (val != "" || !hasDefault) {
+		return val, nil
+	}
+	if hasDefault {
+		return def, nil
+	}
+	return "", fmt.Errorf("environment variable '%s' is not set (use ${%s:-default} to provide a default)", name, name)
+}
+
+// isEnvName 判断是否为合法的环境变量名：字母、数字和下划线，不以数字开头
+func isEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if c != '_' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("ANYRUN_TEST_SET", "value")
+	t.Setenv("ANYRUN_TEST_EMPTY", "")
+	os.Unsetenv("ANYRUN_TEST_UNSET")
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input   string
+		want    string
+		wantErr string
+	}{
+		{"no references", "no references", ""},
+		{"${ANYRUN_TEST_SET}", "value", ""},
+		{"a-${ANYRUN_TEST_SET}-b", "a-value-b", ""},
+		{"${ANYRUN_TEST_EMPTY}", "", ""},
+		{"${ANYRUN_TEST_EMPTY:-default}", "default", ""},
+		{"${ANYRUN_TEST_UNSET:-de fault}", "de fault", ""},
+		{"${ANYRUN_TEST_SET:-default}", "value", ""},
+		{"$${ANYRUN_TEST_SET}", "${ANYRUN_TEST_SET}", ""},
+		{"pw=${file:" + secret + "}", "pw=s3cret", ""},
+		{"${ANYRUN_TEST_UNSET}", "", "environment variable 'ANYRUN_TEST_UNSET' is not set"},
+		{"${ANYRUN_TEST_SET", "", "unterminated reference"},
+		{"${1BAD}", "", "invalid reference '${1BAD}'"},
+		{"${file:}", "", "missing file path"},
+		{"${file:" + secret + ".missing}", "", "cannot read file"},
+	}
+	for _, tt := range tests {
+		got, err := interpolate(tt.input)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("interpolate(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("interpolate(%q) = %q, %v; want %q", tt.input, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogConfig 描述应用输出的日志文件与轮转方式，应用级配置中未设置的项继承全局配置
+type LogConfig struct {
+	Dir        string `json:"dir" toml:"dir,omitempty"`        // 日志目录，默认 logs
+	Merge      *bool  `json:"merge" toml:"merge,omitempty"`      // 是否把 stdout/stderr 合并到 <name>.log
+	MaxSize    int    `json:"maxSize" toml:"maxSize,omitempty"`    // 单个日志文件的最大大小（MB），超过后轮转
+	MaxAge     int    `json:"maxAge" toml:"maxAge,omitempty"`     // 单个日志文件最长写入时间（小时），超过后轮转，0 表示不限制
+	MaxBackups int    `json:"maxBackups" toml:"maxBackups,omitempty"` // 保留的轮转文件数量
+	Compress   *bool  `json:"compress" toml:"compress,omitempty"`   // 是否 gzip 压缩轮转后的文件
+	Timestamp  *bool  `json:"timestamp" toml:"timestamp,omitempty"`  // 是否在每行前添加时间戳
+}
+
+// 日志配置的默认值
+const (
+	defaultLogDir        = "logs"
+	defaultLogMaxSize    = 10
+	defaultLogMaxBackups = 5
+)
+
+// logTimeFormat 是行首时间戳的格式
+const logTimeFormat = "2006-01-02 15:04:05.000"
+
+// effectiveLogConfig 合并默认值、全局配置和应用配置
+func effectiveLogConfig(global, app *LogConfig) LogConfig {
+	no := false
+	lc := LogConfig{
+		Dir:        defaultLogDir,
+		MaxSize:    defaultLogMaxSize,
+		MaxBackups: defaultLogMaxBackups,
+		Merge:      &no,
+		Compress:   &no,
+		Timestamp:  &no,
+	}
+	for _, c := range []*LogConfig{global, app} {
+		if c == nil {
+			continue
+		}
+		if c.Dir != "" {
+			lc.Dir = c.Dir
+		}
+		if c.Merge != nil {
+			lc.Merge = c.Merge
+		}
+		if c.MaxSize > 0 {
+			lc.MaxSize = c.MaxSize
+		}
+		if c.MaxAge > 0 {
+			lc.MaxAge = c.MaxAge
+		}
+		if c.MaxBackups > 0 {
+			lc.MaxBackups = c.MaxBackups
+		}
+		if c.Compress != nil {
+			lc.Compress = c.Compress
+		}
+		if c.Timestamp != nil {
+			lc.Timestamp = c.Timestamp
+		}
+	}
+	return lc
+}
+
+// appLogConfig 返回应用最终生效的日志配置
+func appLogConfig(app AppConfig) LogConfig {
+	return effectiveLogConfig(currentConfig().Logs, app.Logs)
+}
+
+// appLogPaths 返回应用 stdout 与 stderr 的日志文件路径，合并模式下两者相同
+func appLogPaths(app AppConfig, lc LogConfig) (string, string) {
+	if *lc.Merge {
+		path := filepath.Join(lc.Dir, app.Name+".log")
+		return path, path
+	}
+	return filepath.Join(lc.Dir, app.Name+".out.log"), filepath.Join(lc.Dir, app.Name+".err.log")
+}
+
+// rotatingWriter 把数据写入日志文件，并按大小和时间轮转
+type rotatingWriter struct {
+	mu       sync.Mutex
+	path     string
+	lc       LogConfig
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+func openRotatingWriter(path string, lc LogConfig) (*rotatingWriter, error) {
+	w := &rotatingWriter{path: path, lc: lc}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotatingWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	w.openedAt = time.Now()
+	return nil
+}
+
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	tooBig := w.size > 0 && w.size+int64(len(p)) > int64(w.lc.MaxSize)*1024*1024
+	tooOld := w.lc.MaxAge > 0 && time.Since(w.openedAt) > time.Duration(w.lc.MaxAge)*time.Hour
+	if tooBig || tooOld {
+		if err := w.rotate(); err != nil {
+			fmt.Printf("轮转日志 %s 失败: %v\n", w.path, err)
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate 把当前文件重命名为带时间后缀的备份并重新打开，调用方需持有 w.mu
+func (w *rotatingWriter) rotate() error {
+	w.file.Close()
+	w.file = nil
+	backup := w.path + "." + time.Now().Format("20060102-150405.000")
+	if err := os.Rename(w.path, backup); err != nil {
+		if openErr := w.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	go maintainLogBackups(w.path, backup, w.lc)
+	return nil
+}
+
+// maintainLogBackups 按配置压缩刚轮转出的备份 backup，并清理 path 多余的备份
+func maintainLogBackups(path, backup string, lc LogConfig) {
+	// 同一日志文件的压缩和清理依次执行，清理时不会删除正在压缩的文件
+	lock := logMaintenanceLock(path)
+	lock.Lock()
+	defer lock.Unlock()
+	if *lc.Compress {
+		// 备份可能已被之前的清理删除
+		if err := compressLogFile(backup); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("压缩日志 %s 失败: %v\n", backup, err)
+		}
+	}
+	pruneLogBackups(path, lc.MaxBackups)
+}
+
+// logMaintenanceLocks 是每个日志文件轮转后压缩和清理使用的锁。
+// 按路径而不是按 rotatingWriter 加锁，应用重启后新旧 Writer 写同一个文件时同样互斥。
+var (
+	logMaintenanceMu    sync.Mutex
+	logMaintenanceLocks = map[string]*sync.Mutex{}
+)
+
+// logMaintenanceLock 返回日志文件 path 的压缩和清理使用的锁
+func logMaintenanceLock(path string) *sync.Mutex {
+	logMaintenanceMu.Lock()
+	defer logMaintenanceMu.Unlock()
+	lock, ok := logMaintenanceLocks[path]
+	if !ok {
+		lock = &sync.Mutex{}
+		logMaintenanceLocks[path] = lock
+	}
+	return lock
+}
+
+func (w *rotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// compressLogFile 把轮转后的文件压缩为 .gz 并删除原文件
+func compressLogFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		zw.Close()
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
+
+// pruneLogBackups 只保留最近的 keep 个轮转文件
+func pruneLogBackups(path string, keep int) {
+	backups, err := filepath.Glob(path + ".*")
+	if err != nil || len(backups) <= keep {
+		return
+	}
+	// 备份名以时间为后缀，按名称排序即按时间排序
+	sort.Strings(backups)
+	for _, old := range backups[:len(backups)-keep] {
+		os.Remove(old)
+	}
+}
+
+// copyLogLines 按行把进程输出写入日志文件和内存缓冲，直到管道关闭
+func copyLogLines(r io.Reader, w io.Writer, timestamp bool, ring *logRing, stream string) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	atLineStart := true
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if len(chunk) > 0 {
+			if timestamp && atLineStart {
+				line := make([]byte, 0, len(logTimeFormat)+1+len(chunk))
+				line = append(line, time.Now().Format(logTimeFormat)...)
+				line = append(line, ' ')
+				line = append(line, chunk...)
+				w.Write(line)
+			} else {
+				w.Write(chunk)
+			}
+			atLineStart = chunk[len(chunk)-1] == '\n'
+			ring.append(stream, strings.TrimRight(string(chunk), "\r\n"))
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return
+		}
+	}
+}
+
+// openLogWriters 打开应用 stdout 与 stderr 的日志文件，合并模式下两者为同一个 Writer
+func openLogWriters(app AppConfig, lc LogConfig) (*rotatingWriter, *rotatingWriter, error) {
+	if err := os.MkdirAll(lc.Dir, 0755); err != nil {
+		return nil, nil, err
+	}
+	outPath, errPath := appLogPaths(app, lc)
+	outW, err := openRotatingWriter(outPath, lc)
+	if err != nil {
+		return nil, nil, err
+	}
+	errW := outW
+	if errPath != outPath {
+		if errW, err = openRotatingWriter(errPath, lc); err != nil {
+			outW.Close()
+			return nil, nil, err
+		}
+	}
+	return outW, errW, nil
+}
+
+// startLogCopiers 把两个输出管道的内容写入日志文件和内存缓冲，管道全部关闭后关闭日志文件
+func startLogCopiers(app AppConfig, lc LogConfig, outR, errR *os.File, outW, errW *rotatingWriter) {
+	ring := appLogRing(app.Name)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		copyLogLines(outR, outW, *lc.Timestamp, ring, "stdout")
+		outR.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		copyLogLines(errR, errW, *lc.Timestamp, ring, "stderr")
+		errR.Close()
+	}()
+	go func() {
+		wg.Wait()
+		outW.Close()
+		errW.Close()
+	}()
+}
+
+// attachLogs 把进程的 stdout/stderr 接到日志文件，返回进程启动后（无论成功与否）需要调用的函数。
+// 子进程直接写日志文件，anyrun 跟踪文件的新内容写入内存缓冲并负责轮转，anyrun 不在运行时应用的输出
+// 不会被阻塞。timestamp 模式需要由 anyrun 给每行加上时间戳，输出经命名管道由 anyrun 写入日志文件。
+func attachLogs(app AppConfig, cmd *exec.Cmd, proc *AppProcess) (func(), error) {
+	lc := appLogConfig(app)
+	if *lc.Timestamp {
+		proc.logPipe = true
+		return attachLogPipes(app, lc, cmd)
+	}
+	proc.logPipe = false
+	if err := os.MkdirAll(lc.Dir, 0755); err != nil {
+		return nil, err
+	}
+	outPath, errPath := appLogPaths(app, lc)
+	outF, err := openLogFile(outPath)
+	if err != nil {
+		return nil, err
+	}
+	errF := outF
+	if errPath != outPath {
+		if errF, err = openLogFile(errPath); err != nil {
+			outF.Close()
+			return nil, err
+		}
+	}
+	cmd.Stdout = outF
+	cmd.Stderr = errF
+	followLogFiles(app, lc, proc.done)
+
+	// 子进程继承文件后关闭本进程的副本
+	return func() {
+		outF.Close()
+		errF.Close()
+	}, nil
+}
+
+// openLogFile 以追加方式打开交给子进程的日志文件，轮转时截断文件后子进程的写入从文件开头继续
+func openLogFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+}
+
+// attachLogPipes 通过命名管道接收进程输出，由 anyrun 加上时间戳后写入日志文件
+func attachLogPipes(app AppConfig, lc LogConfig, cmd *exec.Cmd) (func(), error) {
+	outW, errW, err := openLogWriters(app, lc)
+	if err != nil {
+		return nil, err
+	}
+	outR, outPipe, err := openOutputPipe(app.Name, "stdout")
+	if err != nil {
+		outW.Close()
+		errW.Close()
+		return nil, err
+	}
+	errR, errPipe, err := openOutputPipe(app.Name, "stderr")
+	if err != nil {
+		outR.Close()
+		outPipe.Close()
+		outW.Close()
+		errW.Close()
+		return nil, err
+	}
+	cmd.Stdout = outPipe
+	cmd.Stderr = errPipe
+	startLogCopiers(app, lc, outR, errR, outW, errW)
+
+	// 子进程持有写端后关闭本进程的副本，所有持有者退出时读端收到 EOF
+	return func() {
+		outPipe.Close()
+		errPipe.Close()
+	}, nil
+}
+
+// reattachLogs 为重新接管的进程恢复日志采集：直接写日志文件的进程从文件末尾继续跟踪，
+// 经命名管道输出的进程重新打开管道，平台不支持时返回错误
+func reattachLogs(app AppConfig, proc *AppProcess) error {
+	lc := appLogConfig(app)
+	if !proc.logPipe {
+		followLogFiles(app, lc, proc.done)
+		return nil
+	}
+	outR, err := reopenOutputPipe(app.Name, "stdout")
+	if err != nil {
+		return err
+	}
+	errR, err := reopenOutputPipe(app.Name, "stderr")
+	if err != nil {
+		outR.Close()
+		return err
+	}
+	outW, errW, err := openLogWriters(app, lc)
+	if err != nil {
+		outR.Close()
+		errR.Close()
+		return err
+	}
+	startLogCopiers(app, lc, outR, errR, outW, errW)
+	return nil
+}
+
+// logPollInterval 是跟踪日志文件时检查新内容的间隔
+const logPollInterval = 200 * time.Millisecond
+
+// followLogFiles 从当前末尾开始跟踪应用的日志文件，把新的行写入内存缓冲，直到 done 关闭。
+// 合并模式下只有一个文件，其中的行都记为 stdout。
+func followLogFiles(app AppConfig, lc LogConfig, done <-chan struct{}) {
+	ring := appLogRing(app.Name)
+	outPath, errPath := appLogPaths(app, lc)
+	paths := map[string]string{"stdout": outPath}
+	if errPath != outPath {
+		paths["stderr"] = errPath
+	}
+	for stream, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Printf("无法跟踪日志 %s: %v\n", path, err)
+			continue
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			continue
+		}
+		t := &logFollower{path: path, lc: lc, file: f, offset: info.Size(), openedAt: time.Now(), done: done}
+		go func() {
+			copyLogLines(t, io.Discard, false, ring, stream)
+			f.Close()
+		}()
+	}
+}
+
+// logFollower 读取子进程正在写入的日志文件：读到末尾时等待新内容，done 关闭且读完后返回 io.EOF。
+// 文件超过轮转条件时复制为备份后截断（与 logrotate 的 copytruncate 相同，轮转瞬间写入的少量输出可能丢失）。
+type logFollower struct {
+	path     string
+	lc       LogConfig
+	file     *os.File
+	offset   int64
+	openedAt time.Time
+	done     <-chan struct{}
+	finished bool
+}
+
+func (t *logFollower) Read(p []byte) (int, error) {
+	for {
+		n, err := t.file.ReadAt(p, t.offset)
+		if n > 0 {
+			t.offset += int64(n)
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		// 已读到末尾；进程退出后再读一次，保证退出前的输出都已读取
+		if t.finished {
+			return 0, io.EOF
+		}
+		select {
+		case <-t.done:
+			t.finished = true
+		case <-time.After(logPollInterval):
+			t.checkRotate()
+		}
+	}
+}
+
+// checkRotate 在文件被截断时从头读取，超过大小或时间限制时轮转文件
+func (t *logFollower) checkRotate() {
+	info, err := t.file.Stat()
+	if err != nil {
+		return
+	}
+	if info.Size() < t.offset {
+		t.offset = 0
+		return
+	}
+	tooBig := info.Size() > int64(t.lc.MaxSize)*1024*1024
+	tooOld := t.lc.MaxAge > 0 && info.Size() > 0 && time.Since(t.openedAt) > time.Duration(t.lc.MaxAge)*time.Hour
+	if !tooBig && !tooOld {
+		return
+	}
+	backup := t.path + "." + time.Now().Format("20060102-150405.000")
+	if err := copyLogFile(t.path, backup); err != nil {
+		fmt.Printf("轮转日志 %s 失败: %v\n", t.path, err)
+		return
+	}
+	if err := os.Truncate(t.path, 0); err != nil {
+		fmt.Printf("轮转日志 %s 失败: %v\n", t.path, err)
+		return
+	}
+	t.offset = 0
+	t.openedAt = time.Now()
+	go maintainLogBackups(t.path, backup, t.lc)
+}
+
+// copyLogFile 把日志文件 path 的内容复制到新文件 backup
+func copyLogFile(path, backup string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(backup, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(backup)
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logsOptions 是 anyrun logs 命令的参数
+type logsOptions struct {
+	all    bool
+	follow bool
+	lines  int
+	stderr bool
+	grep   *regexp.Regexp
+	since  time.Time
+}
+
+// logPrefixColors 是 --all 模式下轮流使用的应用名颜色
+var logPrefixColors = []string{"\033[36m", "\033[33m", "\033[32m", "\033[35m", "\033[34m", "\033[91m", "\033[96m", "\033[93m"}
+
+// parseLogsArgs 解析 anyrun logs 的参数，应用名可以出现在选项前后
+func parseLogsArgs(args []string) (string, logsOptions, error) {
+	var opts logsOptions
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	fs.BoolVar(&opts.all, "all", false, "显示所有应用的输出")
+	fs.BoolVar(&opts.follow, "f", false, "持续输出新的日志")
+	fs.IntVar(&opts.lines, "n", 200, "显示最后多少行，0 表示全部")
+	fs.BoolVar(&opts.stderr, "stderr", false, "只显示 stderr")
+	pattern := fs.String("grep", "", "只显示匹配该正则表达式的行")
+	since := fs.String("since", "", "只显示该时间之后的日志，例如 10m 或 RFC3339 时间")
+
+	name := ""
+	for {
+		if err := fs.Parse(args); err != nil {
+			return "", opts, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		if name != "" {
+			return "", opts, fmt.Errorf("只能指定一个应用")
+		}
+		name = fs.Arg(0)
+		args = fs.Args()[1:]
+	}
+	if name == "" && !opts.all {
+		return "", opts, fmt.Errorf("用法: anyrun logs <name> [-f] [-n 200] [--stderr] [--grep pattern] [--since 10m] | anyrun logs --all")
+	}
+	if *pattern != "" {
+		re, err := regexp.Compile(*pattern)
+		if err != nil {
+			return "", opts, fmt.Errorf("无效的 --grep: %v", err)
+		}
+		opts.grep = re
+	}
+	t, err := parseLogSince(*since)
+	if err != nil {
+		return "", opts, fmt.Errorf("无效的 --since: %v", err)
+	}
+	opts.since = t
+	return name, opts, nil
+}
+
+// logSource 是一个要输出的日志文件
+type logSource struct {
+	path   string
+	prefix string
+}
+
+// RunLogsCommand 实现 anyrun logs 命令，读取应用写入磁盘的日志
+func RunLogsCommand(config Config, args []string) error {
+	name, opts, err := parseLogsArgs(args)
+	if err != nil {
+		return err
+	}
+
+	var sources []logSource
+	width := 0
+	for _, app := range config.Apps {
+		if opts.all && len(app.Name) > width {
+			width = len(app.Name)
+		}
+	}
+	found := false
+	for i, app := range config.Apps {
+		if !opts.all && app.Name != name {
+			continue
+		}
+		found = true
+		lc := effectiveLogConfig(config.Logs, app.Logs)
+		outPath, errPath := appLogPaths(app, lc)
+		prefix := ""
+		if opts.all {
+			color := logPrefixColors[i%len(logPrefixColors)]
+			prefix = fmt.Sprintf("%s%-*s |\033[0m ", color, width, app.Name)
+		}
+		switch {
+		case opts.stderr || outPath == errPath:
+			sources = append(sources, logSource{path: errPath, prefix: prefix})
+		case opts.all:
+			sources = append(sources, logSource{path: outPath, prefix: prefix}, logSource{path: errPath, prefix: prefix})
+		default:
+			sources = append(sources, logSource{path: outPath, prefix: prefix})
+		}
+	}
+	if !found {
+		return fmt.Errorf("应用 '%s' 未找到", name)
+	}
+
+	var printLock sync.Mutex
+	emitLine := func(src logSource, line string) {
+		if opts.grep != nil && !opts.grep.MatchString(line) {
+			return
+		}
+		printLock.Lock()
+		fmt.Printf("%s%s\n", src.prefix, line)
+		printLock.Unlock()
+	}
+
+	offsets := make([]int64, len(sources))
+	for i, src := range sources {
+		lines, offset, err := readLogTail(src.path, opts.lines, opts.since)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		offsets[i] = offset
+		for _, line := range lines {
+			emitLine(src, line)
+		}
+	}
+	if !opts.follow {
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i, src := range sources {
+		wg.Add(1)
+		go func(src logSource, offset int64) {
+			defer wg.Done()
+			followLogFile(src.path, offset, func(line string) { emitLine(src, line) })
+		}(src, offsets[i])
+	}
+	wg.Wait()
+	return nil
+}
+
+// readLogTail 返回文件最后 n 行（n <= 0 表示全部）以及当前文件大小
+func readLogTail(path string, n int, since time.Time) ([]string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	size := info.Size()
+	if info.ModTime().Before(since) {
+		return nil, size, nil
+	}
+
+	// 从文件末尾向前按块读取，直到凑够 n 行
+	start := int64(0)
+	if n > 0 {
+		const chunk = 64 * 1024
+		start = size
+		count := 0
+		buf := make([]byte, chunk)
+		for start > 0 && count <= n {
+			readSize := int64(chunk)
+			if start < readSize {
+				readSize = start
+			}
+			start -= readSize
+			if _, err := f.ReadAt(buf[:readSize], start); err != nil {
+				return nil, size, err
+			}
+			count += bytes.Count(buf[:readSize], []byte("\n"))
+		}
+	}
+	data := make([]byte, size-start)
+	if _, err := f.ReadAt(data, start); err != nil && err != io.EOF {
+		return nil, size, err
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(data) == 0 {
+		lines = nil
+	}
+	if start > 0 && len(lines) > 0 {
+		// 第一行可能不完整
+		lines = lines[1:]
+	}
+	lines = filterLinesSince(lines, since)
+	if n > 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, size, nil
+}
+
+// filterLinesSince 按行首时间戳过滤，没有时间戳的行沿用前一行的时间
+func filterLinesSince(lines []string, since time.Time) []string {
+	if since.IsZero() {
+		return lines
+	}
+	var result []string
+	keep := true
+	for _, line := range lines {
+		if len(line) >= len(logTimeFormat) {
+			if t, err := time.ParseInLocation(logTimeFormat, line[:len(logTimeFormat)], time.Local); err == nil {
+				keep = !t.Before(since)
+			}
+		}
+		if keep {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// followLogFile 从 offset 开始持续读取文件新增的行，文件被轮转后从新文件开头继续
+func followLogFile(path string, offset int64, emit func(string)) {
+	var partial string
+	last, _ := os.Stat(path)
+	for {
+		time.Sleep(500 * time.Millisecond)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.Size() < offset || (last != nil && !os.SameFile(last, info)) {
+			// 文件被轮转或截断
+			offset = 0
+			partial = ""
+		}
+		last = info
+		if info.Size() == offset {
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		f.Seek(offset, io.SeekStart)
+		r := bufio.NewReader(f)
+		for {
+			line, err := r.ReadString('\n')
+			offset += int64(len(line))
+			if err != nil {
+				partial += line
+				break
+			}
+			emit(partial + strings.TrimRight(line, "\r\n"))
+			partial = ""
+		}
+		f.Close()
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingWriterCompressAndPrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	compress := true
+	w, err := openRotatingWriter(path, LogConfig{MaxSize: 1, MaxBackups: 2, Compress: &compress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	chunk := bytes.Repeat([]byte("x"), 700*1024)
+	for i := 0; i < 8; i++ {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+		// 备份以毫秒时间命名，避免同一毫秒内轮转产生相同的名称
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	// 等待后台的压缩和清理完成：只剩 MaxBackups 个压缩后的备份
+	var backups []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		backups, _ = filepath.Glob(path + ".*")
+		done := len(backups) == 2
+		for _, b := range backups {
+			if !strings.HasSuffix(b, ".gz") {
+				done = false
+			}
+		}
+		if done {
+			return
+		}
+	}
+	t.Errorf("backups = %v, want 2 compressed backups", backups)
+}
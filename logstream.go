@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logRingSize 是每个应用在内存中保留的最近日志行数
+const logRingSize = 1000
+
+// LogLine 是内存日志缓冲中的一行输出
+type LogLine struct {
+	Seq    uint64    `json:"seq"`
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"` // stdout|stderr
+	Text   string    `json:"text"`
+}
+
+// logRing 保存应用最近的输出，并把新行推送给订阅者
+type logRing struct {
+	mu    sync.Mutex
+	lines []LogLine
+	next  int // 下一行写入 lines 的位置
+	seq   uint64
+	subs  map[chan LogLine]struct{}
+}
+
+var logRings = map[string]*logRing{}
+var logRingsLock sync.Mutex
+
+// appLogRing 返回应用的日志缓冲，不存在时创建；应用重启后继续使用同一个缓冲
+func appLogRing(name string) *logRing {
+	logRingsLock.Lock()
+	defer logRingsLock.Unlock()
+	ring, ok := logRings[name]
+	if !ok {
+		ring = &logRing{subs: map[chan LogLine]struct{}{}}
+		logRings[name] = ring
+	}
+	return ring
+}
+
+func (r *logRing) append(stream, text string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	line := LogLine{Seq: r.seq, Time: time.Now(), Stream: stream, Text: text}
+	if len(r.lines) < logRingSize {
+		r.lines = append(r.lines, line)
+	} else {
+		r.lines[r.next] = line
+	}
+	r.next = (r.next + 1) % logRingSize
+	for ch := range r.subs {
+		// 订阅者处理不过来时丢弃该行，避免阻塞应用输出
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+// snapshot 按时间顺序返回缓冲中满足条件的行，tail <= 0 表示不限制行数
+func (r *logRing) snapshot(tail int, since time.Time, afterSeq uint64) []LogLine {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.snapshotLocked(tail, since, afterSeq)
+}
+
+func (r *logRing) snapshotLocked(tail int, since time.Time, afterSeq uint64) []LogLine {
+	ordered := make([]LogLine, 0, len(r.lines))
+	if len(r.lines) < logRingSize {
+		ordered = append(ordered, r.lines...)
+	} else {
+		ordered = append(ordered, r.lines[r.next:]...)
+		ordered = append(ordered, r.lines[:r.next]...)
+	}
+	result := ordered[:0]
+	for _, line := range ordered {
+		if line.Seq <= afterSeq || line.Time.Before(since) {
+			continue
+		}
+		result = append(result, line)
+	}
+	if tail > 0 && len(result) > tail {
+		result = result[len(result)-tail:]
+	}
+	return result
+}
+
+// subscribe 返回缓冲中已有的行以及之后新行的通道，两者之间不会丢行
+func (r *logRing) subscribe(tail int, since time.Time, afterSeq uint64) ([]LogLine, chan LogLine, func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ch := make(chan LogLine, 256)
+	r.subs[ch] = struct{}{}
+	cancel := func() {
+		r.mu.Lock()
+		delete(r.subs, ch)
+		r.mu.Unlock()
+	}
+	return r.snapshotLocked(tail, since, afterSeq), ch, cancel
+}
+
+// parseLogSince 解析 since 参数：相对时长（如 10m）或 RFC3339 时间
+func parseLogSince(val string) (time.Time, error) {
+	if val == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(val); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, val)
+}
+
+// AppLogsHandler 处理 /api/apps/{name}/logs 请求：
+// 默认返回 JSON 数组，follow=true 时通过 SSE 推送，带 WebSocket 升级头时通过 WebSocket 推送
+func AppLogsHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	found := false
+	reloadConfig()
+	for _, app := range currentConfig().Apps {
+		if app.Name == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		http.Error(w, fmt.Sprintf("App '%s' not found", name), 404)
+		return
+	}
+
+	query := r.URL.Query()
+	tail := 0
+	if val := query.Get("tail"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid tail", 400)
+			return
+		}
+		tail = n
+	}
+	since, err := parseLogSince(query.Get("since"))
+	if err != nil {
+		http.Error(w, "Invalid since", 400)
+		return
+	}
+	// EventSource 断线重连时从上次收到的行之后继续
+	var afterSeq uint64
+	if val := r.Header.Get("Last-Event-ID"); val != "" {
+		afterSeq, _ = strconv.ParseUint(val, 10, 64)
+	}
+
+	ring := appLogRing(name)
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		serveLogsWebSocket(w, r, ring, tail, since)
+		return
+	}
+	if query.Get("follow") != "true" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ring.snapshot(tail, since, afterSeq))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	lines, ch, cancel := ring.subscribe(tail, since, afterSeq)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	writeEvent := func(line LogLine) {
+		data, _ := json.Marshal(line)
+		fmt.Fprintf(w, "id: %d\ndata: %s\n\n", line.Seq, data)
+	}
+	for _, line := range lines {
+		writeEvent(line)
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line := <-ch:
+			writeEvent(line)
+			flusher.Flush()
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// websocketGUID 是 RFC 6455 握手中用于计算 Sec-WebSocket-Accept 的固定值
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket 帧类型
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+)
+
+// serveLogsWebSocket 完成 WebSocket 握手，并以文本帧推送 JSON 格式的日志行
+func serveLogsWebSocket(w http.ResponseWriter, r *http.Request, ring *logRing, tail int, since time.Time) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" || !strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") {
+		http.Error(w, "Bad WebSocket handshake", 400)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\n")
+	rw.WriteString("Connection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	var writeLock sync.Mutex
+	writeFrame := func(opcode byte, payload []byte) error {
+		writeLock.Lock()
+		defer writeLock.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return writeWebSocketFrame(conn, opcode, payload)
+	}
+
+	// 读取客户端帧：响应 ping，收到 close 或连接断开时结束推送
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			opcode, payload, err := readWebSocketFrame(rw.Reader)
+			if err != nil {
+				return
+			}
+			switch opcode {
+			case wsOpClose:
+				writeFrame(wsOpClose, payload)
+				return
+			case wsOpPing:
+				writeFrame(wsOpPong, payload)
+			}
+		}
+	}()
+
+	lines, ch, cancel := ring.subscribe(tail, since, 0)
+	defer cancel()
+	for _, line := range lines {
+		data, _ := json.Marshal(line)
+		if writeFrame(wsOpText, data) != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case <-closed:
+			return
+		case line := <-ch:
+			data, _ := json.Marshal(line)
+			if writeFrame(wsOpText, data) != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeWebSocketFrame 写出一个不分片、不带掩码的服务端帧
+func writeWebSocketFrame(conn net.Conn, opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+	if _, err := conn.Write(header); err != nil {
+		return err
+	}
+	_, err := conn.Write(payload)
+	return err
+}
+
+// readWebSocketFrame 读取一个客户端帧并去除掩码
+func readWebSocketFrame(r *bufio.Reader) (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	// 客户端只会发送控制帧，过大的帧视为异常
+	if length > 1<<20 {
+		return 0, nil, fmt.Errorf("websocket frame too large")
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return opcode, payload, nil
+}
@@ -7,7 +7,6 @@ import (
 	"io/fs"
 	"net/http"
 	"os"
-	"time"
 )
 
 //go:embed web/dist/*
@@ -25,13 +24,40 @@ func ServeFrontend() http.Handler {
 }
 
 func main() {
-	config, err := LoadConfig("anyrun.toml")
-	if err != nil {
-		fmt.Printf("警告: 无法加载配置文件: %v\n", err)
+	// --local 表示不连接 anyrun 服务，直接在当前进程中执行命令；--token 用于 HTTP API 认证；--profile 选择配置 profile；
+	// --config 指定配置文件（按扩展名识别 TOML、JSON 或 YAML 格式）
+	local := false
+	token := os.Getenv("ANYRUN_TOKEN")
+	var args []string
+	for i := 1; i < len(os.Args); i++ {
+		switch {
+		case os.Args[i] == "--local":
+			local = true
+		case os.Args[i] == "--token" && i+1 < len(os.Args):
+			token = os.Args[i+1]
+			i++
+		case os.Args[i] == "--profile" && i+1 < len(os.Args):
+			// 覆盖环境变量 ANYRUN_PROFILE
+			configProfile = os.Args[i+1]
+			i++
+		case os.Args[i] == "--config" && i+1 < len(os.Args):
+			configPath = os.Args[i+1]
+			configPathSet = true
+			i++
+		default:
+			args = append(args, os.Args[i])
+		}
+	}
+	// 运行时状态保存在配置文件所在目录，不依赖当前目录
+	setStateDir(findConfigFile(configPath))
+
+	config, loadErr := LoadConfig(configPath)
+	if loadErr != nil {
+		fmt.Printf("警告: 无法加载配置文件: %v\n", loadErr)
 		config = Config{UIPort: 5173} // 使用默认配置
 	}
-	
-	args := os.Args[1:]
+	globalConfig.Store(&config)
+
 	// 直接检查是否有CLI命令参数
 	if len(args) >= 1 {
 		// 处理-printcfg命令
@@ -41,6 +67,58 @@ func main() {
 			fmt.Println(string(b))
 			return
 		}
+		// 处理validate命令：检查配置文件，有错误时逐条输出并以非零状态退出
+		if args[0] == "validate" {
+			if loadErr != nil {
+				fmt.Println(loadErr)
+				os.Exit(1)
+			}
+			if errs := config.Validate(); errs != nil {
+				for _, e := range errs {
+					fmt.Println(e)
+				}
+				os.Exit(1)
+			}
+			fmt.Println("配置校验通过")
+			return
+		}
+		// 处理config命令：查看配置历史版本、比较和回滚
+		if args[0] == "config" {
+			if err := RunConfigCommand(args[1:]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+		// 处理logs命令
+		if args[0] == "logs" {
+			if err := RunLogsCommand(config, args[1:]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+		// status/start/stop 默认交给正在运行的 anyrun 服务执行
+		if !local && len(args) >= 2 && (args[0] == "status" || args[0] == "start" || args[0] == "stop") {
+			if err := RunClientCommand(config.UIPort, token, args[0], args[1]); err != nil {
+				fmt.Println(err)
+				fmt.Println("如需在当前进程中直接执行，请使用 --local")
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	
+	// 配置有误时不启动，避免按错误的配置运行应用
+	if errs := config.Validate(); errs != nil {
+		fmt.Println("配置校验失败:")
+		for _, e := range errs {
+			fmt.Printf("  %v\n", e)
+		}
+		os.Exit(1)
+	}
+
+	if len(args) >= 1 {
 		// 处理status命令
 		if args[0] == "status" && len(args) >= 2 {
 			appName := args[1]
@@ -49,6 +127,12 @@ func main() {
 				if app.Name == appName {
 					found = true
 					status := QueryStatus(app)
+					// --local 不接管进程，由服务启动的应用按状态文件显示
+					if status.Status == string(StateStopped) {
+						if recorded, ok := recordedStatus(app); ok {
+							status = recorded
+						}
+					}
 					b, _ := json.MarshalIndent(status, "", "  ")
 					fmt.Println(string(b))
 					return
@@ -107,28 +191,24 @@ func main() {
 	}
 	
 	// 非CLI模式：启动Web服务
+	// 重新接管上次运行时启动、目前仍在运行的应用，只由长期运行的服务接管
+	restoreProcessState(config.Apps)
+
 		// 启动API服务器
 		go func() {
-			// 等待服务启动
-			time.Sleep(2 * time.Second)
-			// 重新加载配置以获取最新数据
-			loadedConfig, err := LoadConfig("anyrun.toml")
-			if err != nil {
-				fmt.Printf("警告: 无法重新加载配置文件: %v\n", err)
-				return
-			}
-			
-			for _, app := range loadedConfig.Apps {
-				if app.Autostart {
+			// 按依赖顺序自动启动，已被重新接管的应用不再启动
+			var names []string
+			for _, app := range config.Apps {
+				if app.Autostart && QueryStatus(app).Status != "running" {
 					fmt.Printf("自动启动应用: %s\n", app.Name)
-					if err := StartApp(app); err != nil {
-						fmt.Printf("启动应用 %s 失败: %v\n", app.Name, err)
-					}
+					names = append(names, app.Name)
 				}
 			}
+			for name, err := range startWithDependencies(config.Apps, names) {
+				fmt.Printf("启动应用 %s 失败: %v\n", name, err)
+			}
 		}()
 		
 		// 默认启动Web服务
 		StartAPIServer(config.Apps, config.UIPort)
 }
-}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// outputPipePath 返回应用输出所用的命名管道路径
+func outputPipePath(name, stream string) string {
+	return filepath.Join(stateDir, "pipes", name+"."+stream)
+}
+
+// openOutputPipe 创建命名管道作为应用的输出，返回本进程的读端和交给子进程的写端。
+// 子进程以读写方式持有管道，anyrun 重启期间输出会暂存在管道缓冲中而不会触发 SIGPIPE，
+// 重启后可以通过 reopenOutputPipe 继续读取。
+func openOutputPipe(name, stream string) (*os.File, *os.File, error) {
+	path := outputPipePath(name, stream)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, nil, err
+	}
+	os.Remove(path)
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		return nil, nil, err
+	}
+	w, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		w.Close()
+		return nil, nil, err
+	}
+	return r, w, nil
+}
+
+// reopenOutputPipe 重新打开仍被子进程持有的命名管道的读端
+func reopenOutputPipe(name, stream string) (*os.File, error) {
+	return os.OpenFile(outputPipePath(name, stream), os.O_RDONLY|syscall.O_NONBLOCK, 0)
+}
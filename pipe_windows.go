@@ -0,0 +1,18 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// openOutputPipe 返回匿名管道的读端和交给子进程的写端
+func openOutputPipe(name, stream string) (*os.File, *os.File, error) {
+	return os.Pipe()
+}
+
+// reopenOutputPipe 在 Windows 上不支持，匿名管道随 anyrun 退出而关闭
+func reopenOutputPipe(name, stream string) (*os.File, error) {
+	return nil, fmt.Errorf("reattaching output is not supported on windows")
+}
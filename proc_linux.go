@@ -0,0 +1,125 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// cgroupRoot 是 anyrun 在 cgroup v2 层级下创建的父 cgroup
+const cgroupRoot = "/sys/fs/cgroup/anyrun"
+
+// cgroup2SuperMagic 是 cgroup v2 文件系统的 statfs 类型
+const cgroup2SuperMagic = 0x63677270
+
+// processParents 读取 /proc 返回 pid -> ppid 的映射
+func processParents() (map[int]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	parents := map[int]int{}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join("/proc", e.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		// 进程名可能包含空格和括号，从最后一个 ')' 之后开始解析
+		stat := string(data)
+		fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+		if len(fields) < 2 {
+			continue
+		}
+		if ppid, err := strconv.Atoi(fields[1]); err == nil {
+			parents[pid] = ppid
+		}
+	}
+	return parents, nil
+}
+
+// cgroupMu 保证 removeCgroup 不会在新进程加入 cgroup 之前删除目录：setupCgroup 持有它直到进程启动
+var cgroupMu sync.Mutex
+
+// setupCgroup 为应用创建 cgroup，并让进程在 clone 时直接加入该 cgroup
+func setupCgroup(name string, cmd *exec.Cmd) (string, func(), error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(filepath.Dir(cgroupRoot), &st); err != nil {
+		return "", nil, err
+	}
+	if st.Type != cgroup2SuperMagic {
+		return "", nil, fmt.Errorf("%s is not a cgroup v2 mount", filepath.Dir(cgroupRoot))
+	}
+	dir := filepath.Join(cgroupRoot, name)
+	cgroupMu.Lock()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		cgroupMu.Unlock()
+		return "", nil, err
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		cgroupMu.Unlock()
+		return "", nil, err
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(f.Fd())
+	return dir, func() {
+		f.Close()
+		cgroupMu.Unlock()
+	}, nil
+}
+
+// removeCgroup 删除应用的 cgroup 目录，最多等待 wait 让其中被结束的进程退出。
+// cgroup 中仍有进程时保留目录，下次启动时继续使用。
+func removeCgroup(dir string, wait time.Duration) {
+	deadline := time.Now().Add(wait)
+	for len(cgroupPIDs(dir)) > 0 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	cgroupMu.Lock()
+	defer cgroupMu.Unlock()
+	if err := syscall.Rmdir(dir); err != nil && err != syscall.EBUSY && err != syscall.ENOENT {
+		fmt.Printf("删除 cgroup %s 失败: %v\n", dir, err)
+	}
+}
+
+// cgroupPIDs 返回 cgroup 中的所有进程
+func cgroupPIDs(dir string) []int {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return nil
+	}
+	var pids []int
+	for _, line := range strings.Fields(string(data)) {
+		if pid, err := strconv.Atoi(line); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// killCgroup 强制结束 cgroup 中的所有进程
+func killCgroup(dir string) error {
+	// 内核 5.14 起支持 cgroup.kill，旧内核逐个发送 SIGKILL
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.kill"), []byte("1"), 0644); err == nil {
+		return nil
+	}
+	for _, pid := range cgroupPIDs(dir) {
+		syscall.Kill(pid, syscall.SIGKILL)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveCgroup(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "app")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	removeCgroup(dir, 0)
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("cgroup directory still exists: %v", err)
+	}
+	// 目录已经不存在时不报错
+	removeCgroup(dir, 0)
+}
@@ -0,0 +1,52 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// processParents 通过 ps 返回 pid -> ppid 的映射
+func processParents() (map[int]int, error) {
+	if runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("listing processes is not supported on windows")
+	}
+	out, err := exec.Command("ps", "-A", "-o", "pid=", "-o", "ppid=").Output()
+	if err != nil {
+		return nil, err
+	}
+	parents := map[int]int{}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		pid, err1 := strconv.Atoi(fields[0])
+		ppid, err2 := strconv.Atoi(fields[1])
+		if err1 == nil && err2 == nil {
+			parents[pid] = ppid
+		}
+	}
+	return parents, nil
+}
+
+// setupCgroup 仅在 Linux 上可用
+func setupCgroup(name string, cmd *exec.Cmd) (string, func(), error) {
+	return "", nil, fmt.Errorf("cgroup kill mode is only supported on linux")
+}
+
+func removeCgroup(dir string, wait time.Duration) {
+}
+
+func cgroupPIDs(dir string) []int {
+	return nil
+}
+
+func killCgroup(dir string) error {
+	return fmt.Errorf("cgroup kill mode is only supported on linux")
+}
@@ -0,0 +1,33 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// setProcessGroup 在 Windows 上为应用创建新的进程组
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// signalProcessGroup 在 Windows 上只支持强制结束整个进程树
+func signalProcessGroup(pgid int, sig syscall.Signal) error {
+	if sig != syscall.SIGKILL {
+		return fmt.Errorf("signal %v not supported on windows", sig)
+	}
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pgid)).Run()
+}
+
+// shellCommand 构造通过 cmd.exe /C 执行命令行的命令，命令行原样传给 cmd.exe，不再经过参数转义
+func shellCommand(line string) *exec.Cmd {
+	cmd := exec.Command("cmd.exe")
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: "cmd.exe /C " + line}
+	return cmd
+}
@@ -13,28 +13,64 @@ type AppStatus struct {
 	Name   string
 	PID    int
 	Path   string
-	Status string // running/stopped
+	Status string // stopped/starting/running/stopping/exited/backoff/failed
 	Port   int    // 应用监听的端口
 	StartTime string // 应用启动时间
+	Restarts    int    // 连续自动重启次数
+	NextRestart string // 下一次自动重启的时间（仅 backoff 状态）
+	ExitCode    int    // 最近一次退出码
+	Health      string // 健康状态：starting/healthy/unhealthy，未配置健康检查时为空
+	Children    []int  // 主进程的所有后代进程
 }
 
 // 添加一个结构体来跟踪应用进程和启动时间
 type AppProcess struct {
 	Cmd       *exec.Cmd
 	StartTime time.Time
+
+	done        chan struct{} // 进程退出后关闭
+	killMode    string        // 停止范围
+	cgroup      string        // cgroup 模式下应用所在的 cgroup 目录
+	fingerprint string        // 进程启动时间指纹，用于重新接管时识别 PID 复用
+	cmdLine     []string      // 展开 ${...} 引用之前的命令行，记录到状态文件中
+	logPipe     bool          // 输出经命名管道由 anyrun 写入日志文件（timestamp 模式）
 }
 
-var appProcesses = map[string]*AppProcess{}
+// buildCommand 根据应用配置构造启动命令，并设置工作目录和环境变量
+func buildCommand(app AppConfig) (*exec.Cmd, error) {
+	// 工作目录改变时，先把相对路径的可执行文件和 AppPath 转为绝对路径，
+	// shell 模式下拼成的命令行中也是绝对路径，保证它们仍然指向配置中的文件
+	if appWorkDir(app) != "" {
+		app = absAppPaths(app)
+	}
 
-func StartApp(app AppConfig) error {
+	cmd, err := appCommand(app)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyEnv(app, cmd); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// appCommand 根据应用配置构造命令行，不设置工作目录和环境变量
+func appCommand(app AppConfig) (*exec.Cmd, error) {
+	// 解析参数，shell 模式下参数原样交给 shell
+	var appArgs []string
+	if !app.Shell {
+		var err error
+		if appArgs, err = app.Args.Fields(); err != nil {
+			return nil, err
+		}
+	}
+	
 	// 构造命令：如果 Execute 是 java 且 AppPath 以 .jar 结尾，则使用 -jar
 	var cmd *exec.Cmd
 	if app.Execute == "java" {
 		if strings.HasSuffix(app.AppPath, ".jar") {
 			args := []string{"-jar", app.AppPath}
-			if app.Args != "" {
-				args = append(args, strings.Fields(app.Args)...)
-			}
+			args = append(args, appArgs...)
 			cmd = exec.Command("java", args...)
 		} else {
 			// 把 AppPath 当作 class 或其他参数
@@ -42,9 +78,7 @@ func StartApp(app AppConfig) error {
 			if app.AppPath != "" {
 				args = append(args, app.AppPath)
 			}
-			if app.Args != "" {
-				args = append(args, strings.Fields(app.Args)...)
-			}
+			args = append(args, appArgs...)
 			cmd = exec.Command("java", args...)
 		}
 	} else if app.Execute == "npm" {
@@ -53,18 +87,14 @@ func StartApp(app AppConfig) error {
 		if app.AppPath != "" {
 			args = append(args, app.AppPath)
 		}
-		if app.Args != "" {
-			args = append(args, strings.Fields(app.Args)...)
-		}
+		args = append(args, appArgs...)
 		cmd = exec.Command("npm", args...)
 	} else if app.Execute == "python" {
 		args := []string{}
 		if app.AppPath != "" {
 			args = append(args, app.AppPath)
 		}
-		if app.Args != "" {
-			args = append(args, strings.Fields(app.Args)...)
-		}
+		args = append(args, appArgs...)
 		cmd = exec.Command("python", args...)
 	} else {
 		// 通用可执行器或直接可执行文件
@@ -72,9 +102,7 @@ func StartApp(app AppConfig) error {
 		if app.AppPath != "" {
 			parts = append(parts, app.AppPath)
 		}
-		if app.Args != "" {
-			parts = append(parts, strings.Fields(app.Args)...)
-		}
+		parts = append(parts, appArgs...)
 		
 		// 特殊处理Windows系统中的系统命令
 		if runtime.GOOS == "windows" {
@@ -85,7 +113,7 @@ func StartApp(app AppConfig) error {
 			} else if app.AppPath != "" {
 				cmd = exec.Command(app.AppPath, parts...)
 			} else {
-				return fmt.Errorf("no execute or appPath specified")
+				return nil, fmt.Errorf("no execute or appPath specified")
 			}
 		} else {
 			if app.Execute != "" {
@@ -93,134 +121,75 @@ func StartApp(app AppConfig) error {
 			} else if app.AppPath != "" {
 				cmd = exec.Command(app.AppPath, parts...)
 			} else {
-				return fmt.Errorf("no execute or appPath specified")
+				return nil, fmt.Errorf("no execute or appPath specified")
 			}
 		}
 	}
 	
-	err := cmd.Start()
-	if err != nil {
-		return err
+	// shell 模式：把命令拼成一行交给 /bin/sh -c（Windows 上为 cmd.exe /C）执行
+	if app.Shell {
+		line := shellJoin(cmd.Args)
+		if !app.Args.IsEmpty() {
+			line += " " + app.Args.ShellLine()
+		}
+		cmd = shellCommand(line)
 	}
-	
-	// 保存进程和启动时间
-	appProcesses[app.Name] = &AppProcess{
-		Cmd:       cmd,
-		StartTime: time.Now(),
+	return cmd, nil
+}
+
+// StartApp 启动应用并等待其就绪，应用已在启动或运行时返回 *TransitionError
+func StartApp(app AppConfig) error {
+	return supervisor.Start(app)
+}
+
+// 未配置 timeout 时的默认超时
+const (
+	defaultStartTimeout = 30 * time.Second
+	defaultStopTimeout  = 5 * time.Second
+)
+
+// startTimeout 返回等待应用就绪的超时：startTimeout > timeout > 默认值
+func startTimeout(app AppConfig) time.Duration {
+	if app.StartTimeout > 0 {
+		return time.Duration(app.StartTimeout) * time.Second
 	}
-	
-	// 等待一小段时间以确认进程启动
-	time.Sleep(500 * time.Millisecond)
-	
-	// 检查进程是否仍在运行 (改进Windows环境下的处理)
-	if cmd.Process != nil {
-		// 在所有平台上都使用 PID 检查进程是否存在
-		// 检查PID是否有效（大于0）
-		if cmd.Process.Pid <= 0 {
-			delete(appProcesses, app.Name)
-			return fmt.Errorf("process exited immediately after start")
-		}
-		
-		// 在Windows上，我们使用一个更简单的方法
-		// 我们假设如果进程启动后短时间内仍然有有效的PID，那么它就在运行
-	} else {
-		delete(appProcesses, app.Name)
-		return fmt.Errorf("failed to get process")
+	if app.Timeout > 0 {
+		return time.Duration(app.Timeout) * time.Second
 	}
-	
-	go func() {
-		if app.Daemon {
-			cmd.Wait()
-		}
-	}()
-	return nil
+	return defaultStartTimeout
 }
 
-func StopApp(app AppConfig) error {
-	appProc, ok := appProcesses[app.Name]
-	if !ok || appProc.Cmd.Process == nil {
-		return fmt.Errorf("app not running")
+// stopTimeout 返回发送停止信号后等待进程退出的超时：stopTimeout > timeout > 默认值
+func stopTimeout(app AppConfig) time.Duration {
+	if app.StopTimeout > 0 {
+		return time.Duration(app.StopTimeout) * time.Second
 	}
-	
-	cmd := appProc.Cmd
-	
-	// 根据操作系统选择合适的信号
-	if runtime.GOOS == "windows" {
-		// Windows不支持SIGTERM，直接Kill
-		err := cmd.Process.Kill()
-		if err != nil {
-			return err
-		}
-	} else {
-		// Unix-like系统尝试优雅地停止进程
-		err := cmd.Process.Signal(syscall.SIGTERM)
-		if err != nil {
-			// 如果优雅停止失败，则强制杀死进程
-			err = cmd.Process.Kill()
-			if err != nil {
-				return err
-			}
-		}
+	if app.Timeout > 0 {
+		return time.Duration(app.Timeout) * time.Second
 	}
-	
-	// 等待进程退出
-	done := make(chan error, 1)
-	go func() {
-		_, err := cmd.Process.Wait()
-		done <- err
-	}()
-	
-	select {
-	case <-done:
-		// 进程已退出
-	case <-time.After(5 * time.Second):
-		// 超时，强制杀死进程
-		cmd.Process.Kill()
+	return defaultStopTimeout
+}
+
+// stopSignal 解析应用配置的停止信号，支持带或不带 SIG 前缀
+func stopSignal(app AppConfig) (syscall.Signal, error) {
+	switch strings.TrimPrefix(strings.ToUpper(app.StopSignal), "SIG") {
+	case "", "TERM":
+		return syscall.SIGTERM, nil
+	case "INT":
+		return syscall.SIGINT, nil
+	case "QUIT":
+		return syscall.SIGQUIT, nil
+	case "HUP":
+		return syscall.SIGHUP, nil
 	}
-	
-	delete(appProcesses, app.Name)
-	return nil
+	return 0, fmt.Errorf("unsupported stop signal %q", app.StopSignal)
+}
+
+// StopApp 停止应用并等待进程退出，应用未运行时返回 *TransitionError
+func StopApp(app AppConfig) error {
+	return supervisor.Stop(app)
 }
 
 func QueryStatus(app AppConfig) AppStatus {
-	appProc, ok := appProcesses[app.Name]
-	status := "stopped"
-	pid := 0
-	startTime := ""
-	
-	if ok && appProc.Cmd.Process != nil {
-		// 检查进程是否仍在运行
-		if runtime.GOOS == "windows" {
-			// Windows检查
-			if appProc.Cmd.Process.Pid > 0 {
-				status = "running"
-				pid = appProc.Cmd.Process.Pid
-				startTime = appProc.StartTime.Format("2006-01-02 15:04:05")
-			} else {
-				// 进程不存在，从映射中删除
-				delete(appProcesses, app.Name)
-			}
-		} else {
-			// Unix-like系统使用标准的信号检查
-			err := appProc.Cmd.Process.Signal(syscall.Signal(0))
-			if err == nil {
-				// 进程存在
-				status = "running"
-				pid = appProc.Cmd.Process.Pid
-				startTime = appProc.StartTime.Format("2006-01-02 15:04:05")
-			} else {
-				// 进程不存在，从映射中删除
-				delete(appProcesses, app.Name)
-			}
-		}
-	}
-	
-	return AppStatus{
-		Name:      app.Name,
-		PID:       pid,
-		Path:      app.AppPath,
-		Status:    status,
-		Port:      app.Port,
-		StartTime: startTime,
-	}
-}
\ No newline at end of file
+	return supervisor.Status(app)
+}
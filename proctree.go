@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"syscall"
+)
+
+// 停止应用时的作用范围
+const (
+	KillModeProcess = "process" // 只向直接子进程发送信号
+	KillModeGroup   = "group"   // 向整个进程组发送信号（默认）
+	KillModeCgroup  = "cgroup"  // 进程组 + 结束 cgroup 中的所有进程（仅 Linux）
+)
+
+// killMode 返回应用的停止范围，未配置时为 group
+func killMode(app AppConfig) string {
+	switch app.KillMode {
+	case KillModeProcess, KillModeCgroup:
+		return app.KillMode
+	}
+	return KillModeGroup
+}
+
+// prepareProcessTree 在进程启动前按停止范围设置进程组或 cgroup，返回启动后需要执行的清理函数
+func prepareProcessTree(app AppConfig, appProc *AppProcess, cmd *exec.Cmd) func() {
+	appProc.killMode = killMode(app)
+	appProc.cgroup = ""
+	if appProc.killMode == KillModeProcess {
+		return func() {}
+	}
+	setProcessGroup(cmd)
+	if appProc.killMode != KillModeCgroup {
+		return func() {}
+	}
+	dir, cleanup, err := setupCgroup(app.Name, cmd)
+	if err != nil {
+		// cgroup 不可用时退回到进程组模式
+		fmt.Printf("应用 %s 无法使用 cgroup，改用进程组: %v\n", app.Name, err)
+		appProc.killMode = KillModeGroup
+		return func() {}
+	}
+	appProc.cgroup = dir
+	return cleanup
+}
+
+// signalApp 按停止范围向应用发送信号
+func signalApp(appProc *AppProcess, sig syscall.Signal) error {
+	if appProc.killMode == KillModeProcess {
+		return appProc.Cmd.Process.Signal(sig)
+	}
+	return signalProcessGroup(appProc.Cmd.Process.Pid, sig)
+}
+
+// killApp 按停止范围强制结束应用的所有进程
+func killApp(appProc *AppProcess) error {
+	if appProc.killMode == KillModeProcess {
+		return appProc.Cmd.Process.Kill()
+	}
+	if appProc.cgroup != "" {
+		killCgroup(appProc.cgroup)
+	}
+	err := signalProcessGroup(appProc.Cmd.Process.Pid, syscall.SIGKILL)
+	if err != nil {
+		// 进程组可能已经不存在，确保直接子进程被结束
+		return appProc.Cmd.Process.Kill()
+	}
+	return nil
+}
+
+// descendantPIDs 返回应用主进程的所有后代进程（cgroup 模式下包含 cgroup 中的其他进程）
+func descendantPIDs(appProc *AppProcess) []int {
+	root := appProc.Cmd.Process.Pid
+	seen := map[int]bool{root: true}
+	var pids []int
+	if parents, err := processParents(); err == nil {
+		children := map[int][]int{}
+		for pid, ppid := range parents {
+			children[ppid] = append(children[ppid], pid)
+		}
+		queue := []int{root}
+		for len(queue) > 0 {
+			pid := queue[0]
+			queue = queue[1:]
+			for _, child := range children[pid] {
+				if !seen[child] {
+					seen[child] = true
+					pids = append(pids, child)
+					queue = append(queue, child)
+				}
+			}
+		}
+	}
+	if appProc.cgroup != "" {
+		for _, pid := range cgroupPIDs(appProc.cgroup) {
+			if !seen[pid] {
+				seen[pid] = true
+				pids = append(pids, pid)
+			}
+		}
+	}
+	sort.Ints(pids)
+	return pids
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// configProfile 是当前使用的配置 profile，由 --profile 参数或环境变量 ANYRUN_PROFILE 指定
+var configProfile = os.Getenv("ANYRUN_PROFILE")
+
+// profileFile 返回 profile 对应的覆盖文件，例如 anyrun.toml 的 prod profile 为同一目录下的 anyrun.prod.toml
+func profileFile(path, profile string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + profile + ext
+}
+
+// applyProfile 把 profile 叠加到配置上：先叠加主配置文件中的 [profiles.<name>]，再叠加 profile 文件。
+// 子表按键深度合并，[[apps]] 按 name 合并到已有的应用（不存在时新增），其余的值直接替换。
+// 叠加只影响运行时的配置，配置接口修改的仍是基础配置。
+func applyProfile(cfg *Config, path string, data []byte, profile string) error {
+	type overlay struct {
+		file  string
+		data  []byte
+		table *tomlTable
+	}
+	var overlays []overlay
+	root, err := parseConfigDocument(path, data)
+	if err != nil {
+		return err
+	}
+	if profiles, ok := root.values["profiles"].(*tomlTable); ok {
+		if t, ok := profiles.values[profile].(*tomlTable); ok {
+			overlays = append(overlays, overlay{path, data, t})
+		}
+	}
+	file := profileFile(path, profile)
+	if fileData, err := os.ReadFile(file); err == nil {
+		t, err := parseConfigDocument(file, fileData)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		overlays = append(overlays, overlay{file, fileData, t})
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if len(overlays) == 0 {
+		return fmt.Errorf("profile '%s' not found: no [profiles.%s] in %s and no %s", profile, profile, path, file)
+	}
+
+	for _, o := range overlays {
+		if err := overlayConfig(cfg, o.file, o.data, o.table); err != nil {
+			return fmt.Errorf("%s: %v", o.file, err)
+		}
+	}
+	return nil
+}
+
+// overlayConfig 把一个覆盖表解码到已有的配置上，表中没有出现的键保持原值
+func overlayConfig(cfg *Config, file string, data []byte, t *tomlTable) error {
+	d := &tomlDecoder{data: data, warn: func(line int, key string) {
+		fmt.Printf("未知配置项在 %s 第%d行: %s\n", file, line, key)
+	}}
+	rest := *t
+	rest.keys = nil
+	var apps []*tomlTable
+	for _, key := range t.keys {
+		switch key {
+		case "apps":
+			arr, ok := t.values[key].(*tomlArrayOfTables)
+			if !ok {
+				return d.errorf(t.pos[key], "apps: expected [[apps]] tables, found %s", tomlTypeName(t.values[key]))
+			}
+			apps = arr.tables
+		case "include", "profiles", "templates":
+			return d.errorf(t.pos[key], "%s cannot be set in a profile", key)
+		default:
+			rest.keys = append(rest.keys, key)
+		}
+	}
+	if err := d.decodeTable(&rest, reflect.ValueOf(cfg).Elem(), ""); err != nil {
+		return err
+	}
+
+	for _, at := range apps {
+		name, _ := at.values["name"].(string)
+		if name == "" {
+			return d.errorf(at.start, "apps: every [[apps]] entry in a profile needs a name")
+		}
+		i, ok := cfg.findApp(name)
+		if !ok {
+			// 新增的应用可以引用模板
+			var app AppConfig
+			template, _ := at.values["template"].(string)
+			if tmpl, ok := cfg.Templates[template]; ok && template != "" {
+				app = cloneApp(tmpl)
+			}
+			cfg.Apps = append(cfg.Apps, app)
+			i = len(cfg.Apps) - 1
+		}
+		if err := d.decodeTable(at, reflect.ValueOf(&cfg.Apps[i]).Elem(), fmt.Sprintf("apps[%d]", i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
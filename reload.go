@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// configChange 是一次重新加载前后的配置
+type configChange struct {
+	old, cfg Config
+}
+
+var (
+	reconcileQueue = make(chan configChange, 16)
+	reconcileOnce  sync.Once
+)
+
+// queueReconcile 把配置变化交给后台按顺序调整，不阻塞调用者
+func queueReconcile(old, cfg Config) {
+	reconcileOnce.Do(func() {
+		go func() {
+			for c := range reconcileQueue {
+				reconcile(c.old, c.cfg)
+			}
+		}()
+	})
+	reconcileQueue <- configChange{old: old, cfg: cfg}
+}
+
+// reconcile 根据新旧配置调整正在运行的应用：停止被删除的应用，启动新增的自动启动应用，
+// 重启启动相关配置发生变化的运行中应用（restartOnConfigChange = false 时只更新配置）
+func reconcile(old, cfg Config) {
+	oldApps := map[string]AppConfig{}
+	for _, app := range old.Apps {
+		oldApps[app.Name] = app
+	}
+	current := map[string]bool{}
+	var start []string
+	for _, app := range cfg.Apps {
+		current[app.Name] = true
+		prev, ok := oldApps[app.Name]
+		if !ok {
+			if app.Autostart {
+				fmt.Printf("配置新增应用 %s，自动启动\n", app.Name)
+				start = append(start, app.Name)
+			}
+			continue
+		}
+		if reflect.DeepEqual(prev, app) {
+			continue
+		}
+		status := AppState(QueryStatus(app).Status)
+		if launchChanged(prev, app) && restartOnConfigChange(app) && (status == StateRunning || status == StateStarting) {
+			fmt.Printf("应用 %s 的配置已变化，重启应用\n", app.Name)
+			if err := StopApp(prev); err != nil && !isTransitionError(err) {
+				fmt.Printf("停止应用 %s 失败: %v\n", app.Name, err)
+				continue
+			}
+			start = append(start, app.Name)
+			continue
+		}
+		supervisor.Update(app)
+	}
+
+	for _, app := range old.Apps {
+		if current[app.Name] {
+			continue
+		}
+		if QueryStatus(app).Status == string(StateStopped) {
+			continue
+		}
+		fmt.Printf("应用 %s 已从配置中删除，停止应用\n", app.Name)
+		if err := StopApp(app); err != nil && !isTransitionError(err) {
+			fmt.Printf("停止应用 %s 失败: %v\n", app.Name, err)
+		}
+	}
+
+	for name, err := range startWithDependencies(cfg.Apps, start) {
+		fmt.Printf("启动应用 %s 失败: %v\n", name, err)
+	}
+}
+
+// launchChanged 判断两份配置中影响进程启动的字段是否不同
+func launchChanged(a, b AppConfig) bool {
+	launch := func(app AppConfig) []interface{} {
+		return []interface{}{
+			app.Execute, app.AppPath, app.AppType, app.Args, app.Shell,
+			appWorkDir(app), app.Env, app.EnvFile, inheritEnv(app),
+			app.KillMode, app.Logs,
+		}
+	}
+	return !reflect.DeepEqual(launch(a), launch(b))
+}
+
+// restartOnConfigChange 返回配置变化时是否重启应用，默认重启
+func restartOnConfigChange(app AppConfig) bool {
+	return app.RestartOnConfigChange == nil || *app.RestartOnConfigChange
+}
+
+// watchConfig 在配置文件变化或收到 SIGHUP 时重新加载配置，短时间内的多次变化合并为一次
+func watchConfig(path string) {
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			fmt.Println("收到 SIGHUP，重新加载配置")
+			notify()
+		}
+	}()
+	// include 的文件可能随配置变化，每次检查时重新获取
+	go watchConfigFiles(func() []string { return configWatchPatterns(path) }, notify)
+
+	for range changed {
+		time.Sleep(200 * time.Millisecond)
+		select {
+		case <-changed:
+		default:
+		}
+		reloadConfig()
+	}
+}
+
+// pollConfigFiles 定期检查匹配 patterns 的文件的修改时间和大小，用于不支持文件事件的平台
+func pollConfigFiles(patterns func() []string, changed func()) {
+	last := configFilesState(patterns())
+	for {
+		time.Sleep(2 * time.Second)
+		state := configFilesState(patterns())
+		if !maps.Equal(state, last) {
+			changed()
+		}
+		last = state
+	}
+}
+
+// configFilesState 返回匹配各个模式的文件的修改时间和大小
+func configFilesState(patterns []string) map[string]string {
+	state := map[string]string{}
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(pattern)
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil {
+				state[m] = fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+			}
+		}
+	}
+	return state
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"time"
+)
+
+// 重启策略
+const (
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+	RestartNever     = "never"
+)
+
+// 重启退避参数的默认值（秒）
+const (
+	defaultBackoffInitial = 1
+	defaultBackoffMax     = 60
+	defaultResetWindow    = 60
+)
+
+// restartPolicy 返回应用的重启策略，未配置时为 never
+func restartPolicy(app AppConfig) string {
+	switch app.Restart {
+	case RestartAlways, RestartOnFailure:
+		return app.Restart
+	}
+	return RestartNever
+}
+
+// restartBackoff 计算第 retries 次重启前的等待时间：initial * 2^retries，不超过 max
+func restartBackoff(app AppConfig, retries int) time.Duration {
+	initial := app.BackoffInitial
+	if initial <= 0 {
+		initial = defaultBackoffInitial
+	}
+	max := app.BackoffMax
+	if max <= 0 {
+		max = defaultBackoffMax
+	}
+	delay := time.Duration(initial) * time.Second
+	for i := 0; i < retries && delay < time.Duration(max)*time.Second; i++ {
+		delay *= 2
+	}
+	if delay > time.Duration(max)*time.Second {
+		delay = time.Duration(max) * time.Second
+	}
+	return delay
+}
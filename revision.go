@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+)
+
+// errConfigChanged 表示配置文件在客户端读取之后已被修改
+var errConfigChanged = errors.New("config has been modified since it was read")
+
+// configRevision 返回配置内容的版本号（内容哈希），用作 ETag
+func configRevision(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// readConfig 读取并解析当前使用的配置，返回组成配置的文件（第一个为主配置文件，不存在时内容为空）
+// 和整个配置的版本号。配置有误时返回解析错误，文件和版本号仍然有效。
+func readConfig() (Config, []configFile, string, error) {
+	path := findConfigFile(configPath)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return Config{}, nil, "", err
+	}
+	cfg, files, err := loadConfigFiles(path, data)
+	return cfg, files, configFilesRevision(files), err
+}
+
+// readConfigFile 读取当前使用的主配置文件及整个配置（包括 include 引入的文件）的版本号，文件不存在时内容为空
+func readConfigFile() ([]byte, string, error) {
+	_, files, revision, err := readConfig()
+	if files == nil {
+		return nil, "", err
+	}
+	return files[0].data, revision, nil
+}
+
+// etagMatches 判断 If-Match 请求头是否包含指定的版本号，支持 * 和逗号分隔的多个 ETag
+func etagMatches(header, revision string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		tag = strings.Trim(strings.TrimPrefix(tag, "W/"), `"`)
+		if tag == revision {
+			return true
+		}
+	}
+	return false
+}
+
+// writeConfigIfMatch 在配置仍是 ifMatch 对应的版本时把 data 写入主配置文件并返回新的版本号，
+// 否则返回 errConfigChanged。ifMatch 是 If-Match 请求头的值或单个版本号。
+func writeConfigIfMatch(data []byte, ifMatch string) (string, error) {
+	configLock.Lock()
+	defer configLock.Unlock()
+	_, files, current, err := readConfig()
+	if files == nil {
+		return "", err
+	}
+	if !etagMatches(ifMatch, current) {
+		return "", errConfigChanged
+	}
+	written := slices.Clone(files)
+	written[0].data = data
+	if err := commitConfigFiles(files, written); err != nil {
+		return "", err
+	}
+	return configFilesRevision(written), nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// stateDir 保存 anyrun 运行时状态（进程状态、Unix 域套接字、配置历史版本等），
+// 由 setStateDir 设为配置文件所在目录下的 .anyrun
+var stateDir = ".anyrun"
+
+// stateFile 记录正在运行的应用进程，anyrun 重启后据此重新接管
+var stateFile = filepath.Join(stateDir, "state.json")
+
+// setStateDir 把运行时状态目录设为配置文件 configFile 所在目录下的 .anyrun（绝对路径），
+// 使在其他目录中执行的 CLI 与服务使用同一个套接字、状态文件和历史版本
+func setStateDir(configFile string) {
+	dir := filepath.Join(filepath.Dir(configFile), ".anyrun")
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	stateDir = dir
+	stateFile = filepath.Join(dir, "state.json")
+	socketPath = filepath.Join(dir, "anyrun.sock")
+	historyDir = filepath.Join(dir, "history")
+}
+
+// processRecord 是状态文件中的一个进程
+type processRecord struct {
+	Name        string    `json:"name"`
+	PID         int       `json:"pid"`
+	StartTime   time.Time `json:"startTime"`
+	Fingerprint string    `json:"fingerprint"` // 进程启动时间指纹，用于识别 PID 复用
+	CmdLine     []string  `json:"cmdline"`     // 展开 ${...} 引用之前的命令行，不含引用的密钥
+	KillMode    string    `json:"killMode"`
+	Cgroup      string    `json:"cgroup,omitempty"`
+	LogPipe     bool      `json:"logPipe,omitempty"` // 输出经命名管道由 anyrun 写入日志文件
+	Restarts    int       `json:"restarts"`
+}
+
+// saveState 把正在运行的进程写入状态文件，调用方不能持有任何应用的锁
+func (sv *Supervisor) saveState() {
+	sv.saveMu.Lock()
+	defer sv.saveMu.Unlock()
+
+	sv.mu.Lock()
+	apps := make([]*appSupervisor, 0, len(sv.apps))
+	for _, a := range sv.apps {
+		apps = append(apps, a)
+	}
+	sv.mu.Unlock()
+
+	records := []processRecord{}
+	managed := map[string]bool{}
+	for _, a := range apps {
+		managed[a.name] = true
+		a.mu.Lock()
+		if a.proc != nil && (a.state == StateStarting || a.state == StateRunning) {
+			records = append(records, processRecord{
+				Name:        a.name,
+				PID:         a.proc.Cmd.Process.Pid,
+				StartTime:   a.proc.StartTime,
+				Fingerprint: a.proc.fingerprint,
+				CmdLine:     a.proc.cmdLine,
+				KillMode:    a.proc.killMode,
+				Cgroup:      a.proc.cgroup,
+				LogPipe:     a.proc.logPipe,
+				Restarts:    a.restarts,
+			})
+		}
+		a.mu.Unlock()
+	}
+	// 保留不由本进程管理、仍在运行的应用的记录，例如 --local 命令不会覆盖服务接管的进程
+	for _, rec := range readProcessState() {
+		if !managed[rec.Name] && processAlive(rec) {
+			records = append(records, rec)
+		}
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		fmt.Printf("保存进程状态失败: %v\n", err)
+		return
+	}
+	// 状态文件只允许当前用户读写
+	tmp := stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		fmt.Printf("保存进程状态失败: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmp, stateFile); err != nil {
+		fmt.Printf("保存进程状态失败: %v\n", err)
+	}
+}
+
+// readProcessState 读取状态文件中的进程记录
+func readProcessState() []processRecord {
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		return nil
+	}
+	var records []processRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		fmt.Printf("解析进程状态文件失败: %v\n", err)
+		return nil
+	}
+	return records
+}
+
+// processAlive 返回记录的进程是否仍在运行（指纹一致，PID 没有被其他进程复用）
+func processAlive(rec processRecord) bool {
+	fingerprint, err := processFingerprint(rec.PID)
+	return err == nil && fingerprint == rec.Fingerprint
+}
+
+// recordedStatus 按状态文件返回未由本进程管理的应用的状态，供 --local status 使用，不接管进程
+func recordedStatus(app AppConfig) (AppStatus, bool) {
+	if runtime.GOOS == "windows" {
+		return AppStatus{}, false
+	}
+	for _, rec := range readProcessState() {
+		if rec.Name == app.Name && processAlive(rec) {
+			return AppStatus{
+				Name:      app.Name,
+				PID:       rec.PID,
+				Path:      app.AppPath,
+				Status:    string(StateRunning),
+				Port:      app.Port,
+				StartTime: rec.StartTime.Format("2006-01-02 15:04:05"),
+				Restarts:  rec.Restarts,
+			}, true
+		}
+	}
+	return AppStatus{}, false
+}
+
+// restoreProcessState 读取状态文件，重新接管仍在运行且指纹一致的进程并恢复日志采集。
+// 只由长期运行的 anyrun 服务调用，短暂运行的 CLI 命令不接管进程。
+func restoreProcessState(apps []AppConfig) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	for _, rec := range readProcessState() {
+		var app *AppConfig
+		for i := range apps {
+			if apps[i].Name == rec.Name {
+				app = &apps[i]
+				break
+			}
+		}
+		if app == nil {
+			continue
+		}
+		if !processAlive(rec) {
+			// 进程已退出，或 PID 已被其他进程复用
+			continue
+		}
+		proc, err := os.FindProcess(rec.PID)
+		if err != nil {
+			continue
+		}
+		cmd := &exec.Cmd{Args: rec.CmdLine, Process: proc}
+		if len(rec.CmdLine) > 0 {
+			cmd.Path = rec.CmdLine[0]
+		}
+		appProc := &AppProcess{
+			Cmd:         cmd,
+			StartTime:   rec.StartTime,
+			done:        make(chan struct{}),
+			killMode:    rec.KillMode,
+			cgroup:      rec.Cgroup,
+			fingerprint: rec.Fingerprint,
+			cmdLine:     rec.CmdLine,
+			logPipe:     rec.LogPipe,
+		}
+		if err := supervisor.Adopt(*app, appProc, rec.Restarts); err != nil {
+			continue
+		}
+		fmt.Printf("重新接管应用 %s (PID %d)\n", rec.Name, rec.PID)
+		if err := reattachLogs(*app, appProc); err != nil {
+			fmt.Printf("无法恢复应用 %s 的日志采集: %v\n", rec.Name, err)
+		}
+	}
+	supervisor.saveState()
+}
+
+// watchAdoptedApp 轮询重新接管的进程（非本进程的子进程，无法 Wait），进程退出后关闭 done
+func watchAdoptedApp(appProc *AppProcess) {
+	pid := appProc.Cmd.Process.Pid
+	for {
+		time.Sleep(time.Second)
+		fingerprint, err := processFingerprint(pid)
+		if err != nil || fingerprint != appProc.fingerprint {
+			break
+		}
+	}
+	close(appProc.done)
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// AppState 是应用在状态机中的状态：
+//
+//	stopped → starting → running → stopping → stopped
+//	starting/running 异常退出 → exited（不重启）| backoff（等待重启）| failed（超过重试次数）
+type AppState string
+
+const (
+	StateStopped  AppState = "stopped"
+	StateStarting AppState = "starting"
+	StateRunning  AppState = "running"
+	StateStopping AppState = "stopping"
+	StateExited   AppState = "exited"
+	StateBackoff  AppState = "backoff"
+	StateFailed   AppState = "failed"
+)
+
+// TransitionError 表示应用在当前状态下不能执行该操作，API 将其映射为 409 Conflict
+type TransitionError struct {
+	App    string
+	Action string // start|stop
+	State  AppState
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot %s app '%s' while it is %s", e.Action, e.App, e.State)
+}
+
+// isTransitionError 判断错误是否为非法状态转换
+func isTransitionError(err error) bool {
+	var te *TransitionError
+	return errors.As(err, &te)
+}
+
+// 状态机事件
+type eventKind int
+
+const (
+	evStart       eventKind = iota // 启动命令
+	evStop                         // 停止命令
+	evAdopt                        // 接管已在运行的进程
+	evExited                       // 进程退出
+	evReady                        // 就绪检查结束
+	evHealth                       // 健康状态变化
+	evRestart                      // 重启退避结束
+	evStopTimeout                  // 优雅停止超时
+	evUpdate                       // 配置变化，之后的自动重启和启动使用新配置
+)
+
+type appEvent struct {
+	kind     eventKind
+	app      AppConfig   // evStart/evAdopt/evUpdate 携带的最新配置
+	reply    chan error  // 命令的执行结果
+	run      int         // 事件所属的运行序号，用于丢弃过期事件
+	exitCode int         // evExited
+	failed   bool        // evExited：是否异常退出
+	err      error       // evReady：就绪检查失败原因
+	health   string      // evHealth
+	proc     *AppProcess // evAdopt
+	restarts int         // evAdopt：状态文件中记录的重启次数
+}
+
+// appSupervisor 由一个 goroutine 驱动单个应用的状态机，所有状态修改都通过 events 串行执行
+type appSupervisor struct {
+	name   string
+	events chan appEvent
+
+	// mu 保护以下字段，状态机 goroutine 修改时持有，QueryStatus 和状态文件读取时持有
+	mu          sync.Mutex
+	app         AppConfig
+	state       AppState
+	proc        *AppProcess // 当前进程，stopped/exited/backoff/failed 时为 nil
+	restarts    int         // 连续自动重启次数
+	nextRestart time.Time   // 下一次自动重启的时间
+	exitCode    int         // 最近一次退出码
+	health      string      // 健康状态
+
+	// 以下字段只在状态机 goroutine 中访问
+	run          int          // 每次启动进程时递增
+	pendingStart []chan error // 等待就绪结果的启动命令
+	pendingStop  []chan error // 等待进程退出的停止命令
+	timer        *time.Timer  // 重启退避或停止超时定时器
+	dirty        bool         // 需要写入状态文件
+}
+
+// Supervisor 管理所有应用的状态机
+type Supervisor struct {
+	mu     sync.Mutex
+	apps   map[string]*appSupervisor
+	saveMu sync.Mutex // 串行化状态文件写入
+}
+
+var supervisor = &Supervisor{apps: map[string]*appSupervisor{}}
+
+// get 返回应用的状态机，不存在时创建并启动其 goroutine
+func (s *Supervisor) get(app AppConfig) *appSupervisor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.apps[app.Name]
+	if !ok {
+		a = &appSupervisor{
+			name:   app.Name,
+			app:    app,
+			state:  StateStopped,
+			events: make(chan appEvent, 16),
+		}
+		s.apps[app.Name] = a
+		go a.loop()
+	}
+	return a
+}
+
+// lookup 返回已存在的应用状态机
+func (s *Supervisor) lookup(name string) *appSupervisor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.apps[name]
+}
+
+// send 把命令交给应用的状态机并等待结果
+func (a *appSupervisor) send(ev appEvent) error {
+	ev.reply = make(chan error, 1)
+	a.events <- ev
+	return <-ev.reply
+}
+
+// post 从其他 goroutine 向状态机投递事件
+func (a *appSupervisor) post(ev appEvent) {
+	a.events <- ev
+}
+
+// Start 启动应用并等待其就绪
+func (s *Supervisor) Start(app AppConfig) error {
+	return s.get(app).send(appEvent{kind: evStart, app: app})
+}
+
+// Stop 停止应用并等待进程退出
+func (s *Supervisor) Stop(app AppConfig) error {
+	a := s.lookup(app.Name)
+	if a == nil {
+		return &TransitionError{App: app.Name, Action: "stop", State: StateStopped}
+	}
+	return a.send(appEvent{kind: evStop})
+}
+
+// Adopt 接管上次运行时启动、目前仍在运行的进程
+func (s *Supervisor) Adopt(app AppConfig, proc *AppProcess, restarts int) error {
+	return s.get(app).send(appEvent{kind: evAdopt, app: app, proc: proc, restarts: restarts})
+}
+
+// Update 更新应用状态机保存的配置，不影响正在运行的进程
+func (s *Supervisor) Update(app AppConfig) {
+	if a := s.lookup(app.Name); a != nil {
+		a.send(appEvent{kind: evUpdate, app: app})
+	}
+}
+
+// Status 返回应用的当前状态
+func (s *Supervisor) Status(app AppConfig) AppStatus {
+	st := AppStatus{
+		Name:   app.Name,
+		Path:   app.AppPath,
+		Status: string(StateStopped),
+		Port:   app.Port,
+	}
+	a := s.lookup(app.Name)
+	if a == nil {
+		return st
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st.Status = string(a.state)
+	st.Restarts = a.restarts
+	st.ExitCode = a.exitCode
+	if a.proc != nil {
+		st.PID = a.proc.Cmd.Process.Pid
+		st.StartTime = a.proc.StartTime.Format("2006-01-02 15:04:05")
+		st.Health = a.health
+		st.Children = descendantPIDs(a.proc)
+	}
+	if a.state == StateBackoff {
+		st.NextRestart = a.nextRestart.Format("2006-01-02 15:04:05")
+	}
+	return st
+}
+
+// loop 串行处理应用的所有事件
+func (a *appSupervisor) loop() {
+	for ev := range a.events {
+		a.mu.Lock()
+		switch ev.kind {
+		case evStart:
+			a.handleStart(ev)
+		case evStop:
+			a.handleStop(ev)
+		case evAdopt:
+			a.handleAdopt(ev)
+		case evExited:
+			a.handleExited(ev)
+		case evReady:
+			a.handleReady(ev)
+		case evHealth:
+			a.handleHealth(ev)
+		case evRestart:
+			if ev.run == a.run && a.state == StateBackoff {
+				a.timer = nil
+				if err := a.launch(); err != nil {
+					fmt.Printf("重启应用 %s 失败: %v\n", a.name, err)
+					a.scheduleRestart()
+				}
+			}
+		case evStopTimeout:
+			if ev.run == a.run && a.state == StateStopping {
+				// 超时，强制杀死进程
+				killApp(a.proc)
+			}
+		case evUpdate:
+			a.app = ev.app
+			ev.reply <- nil
+		}
+		dirty := a.dirty
+		a.dirty = false
+		a.mu.Unlock()
+
+		// 写状态文件需要读取所有应用，必须在释放本应用的锁之后进行
+		if dirty {
+			supervisor.saveState()
+		}
+	}
+}
+
+// setState 切换状态并标记需要写入状态文件
+func (a *appSupervisor) setState(state AppState) {
+	a.state = state
+	a.dirty = true
+}
+
+// cancelTimer 取消等待中的重启或停止超时
+func (a *appSupervisor) cancelTimer() {
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+}
+
+func (a *appSupervisor) handleStart(ev appEvent) {
+	switch a.state {
+	case StateStarting, StateRunning, StateStopping:
+		ev.reply <- &TransitionError{App: a.name, Action: "start", State: a.state}
+		return
+	}
+	// 手动启动时取消等待中的自动重启，并重新计算重试次数
+	a.cancelTimer()
+	a.app = ev.app
+	a.restarts = 0
+	if err := a.launch(); err != nil {
+		a.setState(StateStopped)
+		ev.reply <- err
+		return
+	}
+	a.pendingStart = append(a.pendingStart, ev.reply)
+}
+
+func (a *appSupervisor) handleStop(ev appEvent) {
+	switch a.state {
+	case StateStopped, StateStopping:
+		ev.reply <- &TransitionError{App: a.name, Action: "stop", State: a.state}
+		return
+	case StateBackoff, StateExited, StateFailed:
+		// 没有进程在运行，只需取消等待中的重启
+		a.cancelTimer()
+		a.setState(StateStopped)
+		ev.reply <- nil
+		return
+	}
+	a.replyStart(fmt.Errorf("app stopped before becoming ready"))
+	a.pendingStop = append(a.pendingStop, ev.reply)
+	a.beginStop()
+}
+
+func (a *appSupervisor) handleAdopt(ev appEvent) {
+	if a.state != StateStopped {
+		ev.reply <- &TransitionError{App: a.name, Action: "adopt", State: a.state}
+		return
+	}
+	a.app = ev.app
+	a.run++
+	a.proc = ev.proc
+	a.restarts = ev.restarts
+	a.health = ""
+	a.setState(StateRunning)
+	run := a.run
+	go func() {
+		// 无法获得非子进程的退出码，按异常退出处理
+		watchAdoptedApp(ev.proc)
+		a.post(appEvent{kind: evExited, run: run, exitCode: -1, failed: true})
+	}()
+	if a.app.Healthcheck != nil {
+		// 健康检查的地址和命令可能含有 ${...} 引用，无法展开时使用原值
+		app := a.app
+		if resolved, err := resolveApp(app); err == nil {
+			app = resolved
+		}
+		a.health = HealthStarting
+		go healthLoop(app, ev.proc.done, func(health string) {
+			a.post(appEvent{kind: evHealth, run: run, health: health})
+		})
+	}
+	ev.reply <- nil
+}
+
+// launch 启动进程并进入 starting 状态，就绪检查的结果通过 evReady 返回
+func (a *appSupervisor) launch() error {
+	// 展开配置中的 ${...} 引用，展开后的值只用于这次启动
+	app, err := resolveApp(a.app)
+	if err != nil {
+		return err
+	}
+	cmd, err := buildCommand(app)
+	if err != nil {
+		return err
+	}
+	// done 在进程退出（或启动失败）时关闭，日志跟踪随之结束
+	proc := &AppProcess{done: make(chan struct{})}
+	closeLogs, err := attachLogs(app, cmd, proc)
+	if err != nil {
+		return fmt.Errorf("failed to open log files: %v", err)
+	}
+	cleanup := prepareProcessTree(app, proc, cmd)
+	err = cmd.Start()
+	cleanup()
+	closeLogs()
+	if err != nil {
+		close(proc.done)
+		return err
+	}
+
+	// 保存进程和启动时间
+	proc.Cmd = cmd
+	proc.StartTime = time.Now()
+	proc.fingerprint, _ = processFingerprint(cmd.Process.Pid)
+	// 状态文件中的命令行使用配置中的原值，不记录 ${file:...} 等引用展开后的密钥
+	if raw, err := appCommand(a.app); err == nil {
+		proc.cmdLine = raw.Args
+	}
+	a.run++
+	a.proc = proc
+	a.nextRestart = time.Time{}
+	a.health = ""
+	a.setState(StateStarting)
+
+	run := a.run
+	go func() {
+		err := cmd.Wait()
+		close(proc.done)
+		a.post(appEvent{kind: evExited, run: run, exitCode: cmd.ProcessState.ExitCode(), failed: err != nil})
+	}()
+	go func() {
+		err := waitReady(app, proc.done)
+		a.post(appEvent{kind: evReady, run: run, err: err})
+	}()
+	if app.Healthcheck != nil {
+		a.health = HealthStarting
+		go healthLoop(app, proc.done, func(health string) {
+			a.post(appEvent{kind: evHealth, run: run, health: health})
+		})
+	}
+	return nil
+}
+
+func (a *appSupervisor) handleReady(ev appEvent) {
+	if ev.run != a.run || a.state != StateStarting {
+		return
+	}
+	if ev.err == nil {
+		if a.app.Healthcheck != nil {
+			a.health = HealthHealthy
+		}
+		a.setState(StateRunning)
+		a.replyStart(nil)
+		return
+	}
+
+	fmt.Printf("应用 %s 未能就绪: %v\n", a.name, ev.err)
+	if len(a.pendingStart) > 0 {
+		// 手动启动未能在期限内就绪，视为启动失败并停止应用
+		a.replyStart(ev.err)
+		a.beginStop()
+		return
+	}
+	// 自动重启未能就绪，杀掉进程后由 handleExited 按重启策略处理
+	killApp(a.proc)
+}
+
+func (a *appSupervisor) handleHealth(ev appEvent) {
+	if ev.run != a.run || a.proc == nil {
+		return
+	}
+	a.health = ev.health
+	hc := a.app.Healthcheck
+	if a.state == StateRunning && ev.health == HealthUnhealthy && hc != nil &&
+		hc.RestartOnUnhealthy && restartPolicy(a.app) != RestartNever {
+		// 杀掉进程，由 handleExited 按重启策略重新拉起
+		fmt.Printf("应用 %s 不健康，强制重启\n", a.name)
+		killApp(a.proc)
+	}
+}
+
+// beginStop 向进程发送停止信号并进入 stopping 状态，超时后强制结束
+func (a *appSupervisor) beginStop() {
+	a.cancelTimer()
+	a.setState(StateStopping)
+	proc := a.proc
+
+	// 根据操作系统选择合适的信号
+	if runtime.GOOS == "windows" {
+		// Windows不支持SIGTERM，直接结束整个进程树
+		killApp(proc)
+	} else {
+		// Unix-like系统使用配置的信号尝试优雅地停止进程
+		sig, err := stopSignal(a.app)
+		if err == nil {
+			err = signalApp(proc, sig)
+		}
+		if err != nil {
+			// 如果优雅停止失败，则强制杀死进程
+			killApp(proc)
+		}
+	}
+
+	run := a.run
+	a.timer = time.AfterFunc(stopTimeout(a.app), func() {
+		a.post(appEvent{kind: evStopTimeout, run: run})
+	})
+}
+
+func (a *appSupervisor) handleExited(ev appEvent) {
+	if ev.run != a.run || a.proc == nil {
+		return
+	}
+	proc := a.proc
+	a.exitCode = ev.exitCode
+	a.proc = nil
+	a.health = ""
+	a.cancelTimer()
+
+	if a.state == StateStopping {
+		// 主进程退出后清理残留的子孙进程
+		if proc.killMode != KillModeProcess && runtime.GOOS != "windows" {
+			killApp(proc)
+		}
+		if proc.cgroup != "" {
+			// 在后台等待被结束的进程退出后删除 cgroup，不持有应用的锁
+			go removeCgroup(proc.cgroup, time.Second)
+		}
+		a.setState(StateStopped)
+		for _, reply := range a.pendingStop {
+			reply <- nil
+		}
+		a.pendingStop = nil
+		return
+	}
+
+	fmt.Printf("应用 %s 已退出，退出码: %d\n", a.name, a.exitCode)
+	if proc.cgroup != "" {
+		// 还有子孙进程在运行时保留 cgroup
+		removeCgroup(proc.cgroup, 0)
+	}
+	a.replyStart(fmt.Errorf("process exited before becoming ready"))
+	policy := restartPolicy(a.app)
+	if policy == RestartNever || (policy == RestartOnFailure && !ev.failed) {
+		a.setState(StateExited)
+		return
+	}
+
+	// 稳定运行足够久后认为已经恢复，重置重试计数
+	window := a.app.ResetWindow
+	if window <= 0 {
+		window = defaultResetWindow
+	}
+	if time.Since(proc.StartTime) >= time.Duration(window)*time.Second {
+		a.restarts = 0
+	}
+	a.scheduleRestart()
+}
+
+// scheduleRestart 按退避时间安排下一次重启
+func (a *appSupervisor) scheduleRestart() {
+	if a.app.MaxRetries > 0 && a.restarts >= a.app.MaxRetries {
+		fmt.Printf("应用 %s 已连续重启 %d 次，放弃重启\n", a.name, a.restarts)
+		a.setState(StateFailed)
+		return
+	}
+
+	delay := restartBackoff(a.app, a.restarts)
+	a.restarts++
+	a.nextRestart = time.Now().Add(delay)
+	a.setState(StateBackoff)
+	fmt.Printf("应用 %s 将在 %v 后进行第 %d 次重启\n", a.name, delay, a.restarts)
+
+	run := a.run
+	a.timer = time.AfterFunc(delay, func() {
+		a.post(appEvent{kind: evRestart, run: run})
+	})
+}
+
+// replyStart 把启动结果返回给所有等待中的启动命令
+func (a *appSupervisor) replyStart(err error) {
+	for _, reply := range a.pendingStart {
+		reply <- err
+	}
+	a.pendingStart = nil
+}
+
+// waitReady 等待应用就绪：配置了健康检查时以检查通过为准，配置了端口时以端口可连接为准，
+// 两者都没有时只确认进程在启动后没有立即退出
+func waitReady(app AppConfig, done chan struct{}) error {
+	if app.Healthcheck == nil && app.Port <= 0 {
+		select {
+		case <-done:
+			return fmt.Errorf("process exited immediately after start")
+		case <-time.After(500 * time.Millisecond):
+		}
+		return nil
+	}
+
+	timeout := startTimeout(app)
+	deadline := time.After(timeout)
+	for {
+		var err error
+		if app.Healthcheck != nil {
+			err = probeHealth(app, app.Healthcheck)
+		} else {
+			var conn net.Conn
+			conn, err = net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", app.Port), time.Second)
+			if err == nil {
+				conn.Close()
+			}
+		}
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-done:
+			return fmt.Errorf("process exited before becoming ready")
+		case <-deadline:
+			return fmt.Errorf("app not ready within %v: %v", timeout, err)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// expandTemplates 展开配置文件 path 的内容 data 中引用了模板的应用：以模板为基础，再把应用自身的配置解码到其上，
+// 子表（env、healthcheck、logs）按键合并，其余的值直接替换。apps 是 data 中 [[apps]] 按顺序解码的结果，
+// 引用了不存在的模板的应用保持原样，由 Validate 报告。
+func expandTemplates(apps []AppConfig, templates map[string]AppConfig, path string, data []byte) error {
+	if len(templates) == 0 {
+		return nil
+	}
+	doc, err := parseConfigDocument(path, data)
+	if err != nil {
+		return err
+	}
+	var tables []*tomlTable
+	switch x := doc.values["apps"].(type) {
+	case *tomlArrayOfTables:
+		tables = x.tables
+	case []interface{}:
+		for _, item := range x {
+			if t, ok := item.(*tomlTable); ok {
+				tables = append(tables, t)
+			}
+		}
+	}
+	if len(tables) != len(apps) {
+		return nil
+	}
+	d := &tomlDecoder{data: data}
+	for i, t := range tables {
+		tmpl, ok := templates[apps[i].Template]
+		if apps[i].Template == "" || !ok {
+			continue
+		}
+		app := cloneApp(tmpl)
+		if err := d.decodeTable(t, reflect.ValueOf(&app).Elem(), fmt.Sprintf("apps[%d]", i)); err != nil {
+			return err
+		}
+		apps[i] = app
+	}
+	return nil
+}
+
+// cloneApp 返回应用配置的深拷贝，在其上解码或修改不会影响原配置
+func cloneApp(app AppConfig) AppConfig {
+	app.Args.List = slices.Clone(app.Args.List)
+	app.DependsOn = slices.Clone(app.DependsOn)
+	app.Env = maps.Clone(app.Env)
+	app.RestartOnConfigChange = cloneBool(app.RestartOnConfigChange)
+	app.InheritEnv = cloneBool(app.InheritEnv)
+	if app.Healthcheck != nil {
+		hc := *app.Healthcheck
+		app.Healthcheck = &hc
+	}
+	if app.Logs != nil {
+		logs := *app.Logs
+		logs.Merge = cloneBool(logs.Merge)
+		logs.Compress = cloneBool(logs.Compress)
+		logs.Timestamp = cloneBool(logs.Timestamp)
+		app.Logs = &logs
+	}
+	return app
+}
+
+func cloneBool(p *bool) *bool {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// withTemplateDefaults 返回写回配置文件用的副本：引用了模板的应用只写出与模板不同的配置，
+// 模板只写出设置了的配置。应用是按 previous 中的模板展开的，与之比较，这样同时修改模板时
+// 没有单独设置的配置仍然跟随模板。
+func (c Config) withTemplateDefaults(previous map[string]AppConfig) Config {
+	if len(c.Templates) == 0 {
+		return c
+	}
+	out := c
+	out.Templates = make(map[string]AppConfig, len(c.Templates))
+	for name, tmpl := range c.Templates {
+		tmpl.base = &AppConfig{}
+		out.Templates[name] = tmpl
+	}
+	out.Apps = make([]AppConfig, len(c.Apps))
+	for i, app := range c.Apps {
+		tmpl, ok := previous[app.Template]
+		if !ok {
+			tmpl, ok = c.Templates[app.Template]
+		}
+		if ok && app.Template != "" {
+			app.base = &tmpl
+		}
+		out.Apps[i] = app
+	}
+	return out
+}
+
+// tomlDefaults 返回写回配置文件时应用的默认值，见 tomlDefaulter
+func (a AppConfig) tomlDefaults() (interface{}, bool) {
+	if a.base == nil {
+		return nil, false
+	}
+	return *a.base, true
+}
@@ -0,0 +1,881 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// TOMLError 是带有行列位置的 TOML 解析或解码错误
+type TOMLError struct {
+	Line int
+	Col  int
+	Msg  string
+}
+
+func (e *TOMLError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Col, e.Msg)
+}
+
+// tomlTable 是解析后的 TOML 表，保留键的出现顺序和位置
+type tomlTable struct {
+	keys   []string
+	values map[string]interface{}
+	pos    map[string]int // 键对应的值在源文件中的字节偏移
+	keyPos map[string]int // key = value 中键的起始偏移
+	end    map[string]int // key = value 中值的结束偏移
+	start  int            // 表头或内联表在源文件中的字节偏移
+
+	explicit bool // 由 [table] 表头定义
+	dotted   bool // 由点分键隐式定义
+	inline   bool // 内联表，定义后不能再扩展
+}
+
+// tomlArrayOfTables 是 [[name]] 定义的表数组
+type tomlArrayOfTables struct {
+	tables []*tomlTable
+}
+
+// tomlDatetime 是 TOML 日期时间值，保留原始文本
+type tomlDatetime string
+
+func newTOMLTable() *tomlTable {
+	return &tomlTable{values: map[string]interface{}{}, pos: map[string]int{}, keyPos: map[string]int{}, end: map[string]int{}}
+}
+
+func (t *tomlTable) set(key string, val interface{}, off int) {
+	if _, ok := t.values[key]; !ok {
+		t.keys = append(t.keys, key)
+	}
+	t.values[key] = val
+	t.pos[key] = off
+}
+
+// tomlParser 按 TOML v1.0.0 规范把文本解析为 tomlTable
+type tomlParser struct {
+	data    []byte
+	off     int
+	root    *tomlTable
+	current *tomlTable
+	headers []int // 所有表头的起始偏移，按出现顺序
+}
+
+// parseTOML 解析 TOML 文本
+func parseTOML(data []byte) (*tomlTable, error) {
+	root, _, err := parseTOMLDocument(data)
+	return root, err
+}
+
+// parseTOMLDocument 解析 TOML 文本，同时返回所有表头的起始偏移，用于原地修改文档
+func parseTOMLDocument(data []byte) (*tomlTable, []int, error) {
+	if !utf8.Valid(data) {
+		return nil, nil, &TOMLError{Line: 1, Col: 1, Msg: "file is not valid UTF-8"}
+	}
+	p := &tomlParser{data: data, root: newTOMLTable()}
+	p.current = p.root
+	if err := p.parse(); err != nil {
+		return nil, nil, err
+	}
+	return p.root, p.headers, nil
+}
+
+// tomlPosition 把字节偏移转换为从 1 开始的行号和列号
+func tomlPosition(data []byte, off int) (int, int) {
+	if off > len(data) {
+		off = len(data)
+	}
+	line, col := 1, 1
+	for _, r := range string(data[:off]) {
+		if r == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
+
+func (p *tomlParser) errorf(off int, format string, args ...interface{}) error {
+	line, col := tomlPosition(p.data, off)
+	return &TOMLError{Line: line, Col: col, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *tomlParser) eof() bool {
+	return p.off >= len(p.data)
+}
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.data[p.off]
+}
+
+func (p *tomlParser) hasPrefix(s string) bool {
+	return strings.HasPrefix(string(p.data[p.off:]), s)
+}
+
+// skipSpace 跳过空格和制表符
+func (p *tomlParser) skipSpace() {
+	for !p.eof() && (p.data[p.off] == ' ' || p.data[p.off] == '\t') {
+		p.off++
+	}
+}
+
+// skipComment 跳过 # 开始的注释，注释中不允许出现控制字符
+func (p *tomlParser) skipComment() error {
+	if p.peek() != '#' {
+		return nil
+	}
+	for !p.eof() && p.data[p.off] != '\n' {
+		c := p.data[p.off]
+		if (c < 0x20 && c != '\t' && c != '\r') || c == 0x7F {
+			return p.errorf(p.off, "control character in comment")
+		}
+		if c == '\r' && p.off+1 < len(p.data) && p.data[p.off+1] != '\n' {
+			return p.errorf(p.off, "bare carriage return in comment")
+		}
+		p.off++
+	}
+	return nil
+}
+
+// skipNewline 跳过一个换行（\n 或 \r\n），没有换行时返回 false
+func (p *tomlParser) skipNewline() bool {
+	if p.hasPrefix("\r\n") {
+		p.off += 2
+		return true
+	}
+	if p.peek() == '\n' {
+		p.off++
+		return true
+	}
+	return false
+}
+
+// skipBlank 跳过空白、注释和换行，用于数组内部
+func (p *tomlParser) skipBlank() error {
+	for {
+		p.skipSpace()
+		if err := p.skipComment(); err != nil {
+			return err
+		}
+		if !p.skipNewline() {
+			return nil
+		}
+	}
+}
+
+// endOfLine 要求当前行剩余部分只有空白和注释
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace()
+	if err := p.skipComment(); err != nil {
+		return err
+	}
+	if p.eof() || p.skipNewline() {
+		return nil
+	}
+	return p.errorf(p.off, "expected end of line, found %q", p.peek())
+}
+
+func (p *tomlParser) parse() error {
+	for {
+		if err := p.skipBlank(); err != nil {
+			return err
+		}
+		if p.eof() {
+			return nil
+		}
+		var err error
+		if p.hasPrefix("[[") {
+			err = p.parseArrayTableHeader()
+		} else if p.peek() == '[' {
+			err = p.parseTableHeader()
+		} else {
+			err = p.parseKeyValue(p.current)
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.endOfLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// parseKey 解析可能带点的键
+func (p *tomlParser) parseKey() ([]string, error) {
+	var parts []string
+	for {
+		p.skipSpace()
+		start := p.off
+		switch c := p.peek(); {
+		case c == '"':
+			if p.hasPrefix(`"""`) {
+				return nil, p.errorf(p.off, "multi-line string cannot be used as a key")
+			}
+			s, err := p.parseBasicString()
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, s)
+		case c == '\'':
+			if p.hasPrefix("'''") {
+				return nil, p.errorf(p.off, "multi-line string cannot be used as a key")
+			}
+			s, err := p.parseLiteralString()
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, s)
+		default:
+			for !p.eof() && isBareKeyChar(p.data[p.off]) {
+				p.off++
+			}
+			if p.off == start {
+				if p.eof() {
+					return nil, p.errorf(p.off, "expected key, found end of file")
+				}
+				return nil, p.errorf(p.off, "invalid character %q in key", p.peek())
+			}
+			parts = append(parts, string(p.data[start:p.off]))
+		}
+		p.skipSpace()
+		if p.peek() != '.' {
+			return parts, nil
+		}
+		p.off++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// parseKeyValue 解析 key = value 并写入 table
+func (p *tomlParser) parseKeyValue(table *tomlTable) error {
+	keyOff := p.off
+	key, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if p.peek() != '=' {
+		return p.errorf(p.off, "expected '=' after key")
+	}
+	p.off++
+	p.skipSpace()
+	valOff := p.off
+	val, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	valEnd := p.off
+
+	// 点分键中间的部分隐式定义子表
+	t := table
+	for _, part := range key[:len(key)-1] {
+		existing, ok := t.values[part]
+		if !ok {
+			sub := newTOMLTable()
+			sub.dotted = true
+			t.set(part, sub, keyOff)
+			t = sub
+			continue
+		}
+		sub, isTable := existing.(*tomlTable)
+		if !isTable || sub.inline || sub.explicit {
+			return p.errorf(keyOff, "cannot define key '%s': '%s' is already defined", strings.Join(key, "."), part)
+		}
+		t = sub
+	}
+	last := key[len(key)-1]
+	if _, ok := t.values[last]; ok {
+		return p.errorf(keyOff, "duplicate key '%s'", strings.Join(key, "."))
+	}
+	t.set(last, val, valOff)
+	t.keyPos[last] = keyOff
+	t.end[last] = valEnd
+	return nil
+}
+
+// parseTableHeader 解析 [a.b] 表头
+func (p *tomlParser) parseTableHeader() error {
+	headerOff := p.off
+	p.off++
+	key, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if p.peek() != ']' {
+		return p.errorf(p.off, "expected ']' after table name")
+	}
+	p.off++
+
+	t, err := p.walkHeader(key, headerOff)
+	if err != nil {
+		return err
+	}
+	p.headers = append(p.headers, headerOff)
+	last := key[len(key)-1]
+	existing, ok := t.values[last]
+	if !ok {
+		sub := newTOMLTable()
+		sub.explicit = true
+		sub.start = headerOff
+		t.set(last, sub, headerOff)
+		p.current = sub
+		return nil
+	}
+	sub, isTable := existing.(*tomlTable)
+	if !isTable || sub.explicit || sub.dotted || sub.inline {
+		return p.errorf(headerOff, "table '%s' is already defined", strings.Join(key, "."))
+	}
+	sub.explicit = true
+	sub.start = headerOff
+	p.current = sub
+	return nil
+}
+
+// parseArrayTableHeader 解析 [[a.b]] 表头，向表数组追加一个新表
+func (p *tomlParser) parseArrayTableHeader() error {
+	headerOff := p.off
+	p.off += 2
+	key, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if !p.hasPrefix("]]") {
+		return p.errorf(p.off, "expected ']]' after array of tables name")
+	}
+	p.off += 2
+
+	t, err := p.walkHeader(key, headerOff)
+	if err != nil {
+		return err
+	}
+	p.headers = append(p.headers, headerOff)
+	last := key[len(key)-1]
+	sub := newTOMLTable()
+	sub.explicit = true
+	sub.start = headerOff
+	existing, ok := t.values[last]
+	if !ok {
+		t.set(last, &tomlArrayOfTables{tables: []*tomlTable{sub}}, headerOff)
+		p.current = sub
+		return nil
+	}
+	arr, isArray := existing.(*tomlArrayOfTables)
+	if !isArray {
+		return p.errorf(headerOff, "'%s' is already defined and is not an array of tables", strings.Join(key, "."))
+	}
+	arr.tables = append(arr.tables, sub)
+	p.current = sub
+	return nil
+}
+
+// walkHeader 沿表头的前缀找到（必要时创建）父表，表数组取最后一个元素
+func (p *tomlParser) walkHeader(key []string, off int) (*tomlTable, error) {
+	t := p.root
+	for i, part := range key[:len(key)-1] {
+		existing, ok := t.values[part]
+		if !ok {
+			sub := newTOMLTable()
+			t.set(part, sub, off)
+			t = sub
+			continue
+		}
+		switch v := existing.(type) {
+		case *tomlTable:
+			if v.inline {
+				return nil, p.errorf(off, "cannot extend inline table '%s'", strings.Join(key[:i+1], "."))
+			}
+			t = v
+		case *tomlArrayOfTables:
+			t = v.tables[len(v.tables)-1]
+		default:
+			return nil, p.errorf(off, "'%s' is not a table", strings.Join(key[:i+1], "."))
+		}
+	}
+	return t, nil
+}
+
+// parseValue 解析一个值
+func (p *tomlParser) parseValue() (interface{}, error) {
+	if p.eof() {
+		return nil, p.errorf(p.off, "expected value, found end of file")
+	}
+	switch c := p.peek(); {
+	case c == '"':
+		if p.hasPrefix(`"""`) {
+			return p.parseMultilineBasicString()
+		}
+		return p.parseBasicString()
+	case c == '\'':
+		if p.hasPrefix("'''") {
+			return p.parseMultilineLiteralString()
+		}
+		return p.parseLiteralString()
+	case c == '[':
+		return p.parseArray()
+	case c == '{':
+		return p.parseInlineTable()
+	case p.hasPrefix("true") && !p.bareContinues(4):
+		p.off += 4
+		return true, nil
+	case p.hasPrefix("false") && !p.bareContinues(5):
+		p.off += 5
+		return false, nil
+	case c == '+' || c == '-' || c >= '0' && c <= '9' || c == 'i' || c == 'n':
+		return p.parseNumberOrDate()
+	}
+	return nil, p.errorf(p.off, "invalid value starting with %q", p.peek())
+}
+
+// bareContinues 判断偏移 n 处是否还有属于同一个值的字符
+func (p *tomlParser) bareContinues(n int) bool {
+	i := p.off + n
+	return i < len(p.data) && isBareKeyChar(p.data[i])
+}
+
+func (p *tomlParser) parseBasicString() (string, error) {
+	start := p.off
+	p.off++
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf(start, "unterminated string")
+		}
+		c := p.data[p.off]
+		switch {
+		case c == '"':
+			p.off++
+			return b.String(), nil
+		case c == '\\':
+			if err := p.parseEscape(&b); err != nil {
+				return "", err
+			}
+		case (c < 0x20 && c != '\t') || c == 0x7F:
+			return "", p.errorf(p.off, "control character in string")
+		default:
+			b.WriteByte(c)
+			p.off++
+		}
+	}
+}
+
+// parseEscape 解析基本字符串中的转义序列
+func (p *tomlParser) parseEscape(b *strings.Builder) error {
+	escOff := p.off
+	p.off++
+	if p.eof() {
+		return p.errorf(escOff, "unterminated escape sequence")
+	}
+	c := p.data[p.off]
+	p.off++
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case '"':
+		b.WriteByte('"')
+	case '\\':
+		b.WriteByte('\\')
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.off+size > len(p.data) {
+			return p.errorf(escOff, "invalid unicode escape")
+		}
+		code, err := strconv.ParseUint(string(p.data[p.off:p.off+size]), 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return p.errorf(escOff, "invalid unicode escape")
+		}
+		b.WriteRune(rune(code))
+		p.off += size
+	default:
+		return p.errorf(escOff, "invalid escape sequence \\%c", c)
+	}
+	return nil
+}
+
+func (p *tomlParser) parseLiteralString() (string, error) {
+	start := p.off
+	p.off++
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf(start, "unterminated literal string")
+		}
+		c := p.data[p.off]
+		if c == '\'' {
+			s := string(p.data[start+1 : p.off])
+			p.off++
+			return s, nil
+		}
+		if (c < 0x20 && c != '\t') || c == 0x7F {
+			return "", p.errorf(p.off, "control character in string")
+		}
+		p.off++
+	}
+}
+
+func (p *tomlParser) parseMultilineBasicString() (string, error) {
+	start := p.off
+	p.off += 3
+	// 紧跟在开头分隔符后的换行不属于字符串
+	p.skipNewline()
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf(start, "unterminated multi-line string")
+		}
+		c := p.data[p.off]
+		switch {
+		case c == '"' && p.hasPrefix(`"""`):
+			// 结尾最多可以多出两个引号，属于字符串内容
+			n := 3
+			for n < 5 && p.off+n < len(p.data) && p.data[p.off+n] == '"' {
+				n++
+			}
+			b.WriteString(strings.Repeat(`"`, n-3))
+			p.off += n
+			return b.String(), nil
+		case c == '\\':
+			// 行尾反斜杠：去掉换行以及下一个非空白字符之前的所有空白
+			i := p.off + 1
+			for i < len(p.data) && (p.data[i] == ' ' || p.data[i] == '\t') {
+				i++
+			}
+			if i < len(p.data) && (p.data[i] == '\n' || p.data[i] == '\r') {
+				p.off = i
+				for !p.eof() && strings.IndexByte(" \t\r\n", p.data[p.off]) >= 0 {
+					p.off++
+				}
+				continue
+			}
+			if err := p.parseEscape(&b); err != nil {
+				return "", err
+			}
+		case c == '\r' && p.hasPrefix("\r\n"):
+			b.WriteString("\r\n")
+			p.off += 2
+		case (c < 0x20 && c != '\t' && c != '\n') || c == 0x7F:
+			return "", p.errorf(p.off, "control character in string")
+		default:
+			b.WriteByte(c)
+			p.off++
+		}
+	}
+}
+
+func (p *tomlParser) parseMultilineLiteralString() (string, error) {
+	start := p.off
+	p.off += 3
+	p.skipNewline()
+	contentStart := p.off
+	for {
+		if p.eof() {
+			return "", p.errorf(start, "unterminated multi-line literal string")
+		}
+		c := p.data[p.off]
+		if c == '\'' && p.hasPrefix("'''") {
+			n := 3
+			for n < 5 && p.off+n < len(p.data) && p.data[p.off+n] == '\'' {
+				n++
+			}
+			s := string(p.data[contentStart:p.off]) + strings.Repeat("'", n-3)
+			p.off += n
+			return s, nil
+		}
+		if (c < 0x20 && c != '\t' && c != '\n' && c != '\r') || c == 0x7F {
+			return "", p.errorf(p.off, "control character in string")
+		}
+		p.off++
+	}
+}
+
+func (p *tomlParser) parseArray() ([]interface{}, error) {
+	start := p.off
+	p.off++
+	arr := []interface{}{}
+	for {
+		if err := p.skipBlank(); err != nil {
+			return nil, err
+		}
+		if p.eof() {
+			return nil, p.errorf(start, "unterminated array")
+		}
+		if p.peek() == ']' {
+			p.off++
+			return arr, nil
+		}
+		val, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, val)
+		if err := p.skipBlank(); err != nil {
+			return nil, err
+		}
+		switch p.peek() {
+		case ',':
+			p.off++
+		case ']':
+			p.off++
+			return arr, nil
+		default:
+			if p.eof() {
+				return nil, p.errorf(start, "unterminated array")
+			}
+			return nil, p.errorf(p.off, "expected ',' or ']' in array, found %q", p.peek())
+		}
+	}
+}
+
+func (p *tomlParser) parseInlineTable() (*tomlTable, error) {
+	start := p.off
+	p.off++
+	t := newTOMLTable()
+	t.start = start
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.off++
+		t.inline = true
+		return t, nil
+	}
+	for {
+		p.skipSpace()
+		if err := p.parseKeyValue(t); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.off++
+		case '}':
+			p.off++
+			markInline(t)
+			return t, nil
+		default:
+			if p.eof() || p.peek() == '\n' {
+				return nil, p.errorf(start, "unterminated inline table")
+			}
+			return nil, p.errorf(p.off, "expected ',' or '}' in inline table, found %q", p.peek())
+		}
+	}
+}
+
+// markInline 把内联表及其点分键定义的子表标记为不可扩展
+func markInline(t *tomlTable) {
+	t.inline = true
+	for _, v := range t.values {
+		if sub, ok := v.(*tomlTable); ok {
+			markInline(sub)
+		}
+	}
+}
+
+// parseNumberOrDate 解析整数、浮点数或日期时间
+func (p *tomlParser) parseNumberOrDate() (interface{}, error) {
+	start := p.off
+	for !p.eof() && strings.IndexByte("0123456789abcdefABCDEFxXoO+-_.:TtZzinf", p.data[p.off]) >= 0 {
+		p.off++
+	}
+	// 日期与时间之间可以用空格分隔
+	if p.off-start == 10 && p.off+3 < len(p.data) && p.data[p.off] == ' ' &&
+		isDigit(p.data[p.off+1]) && isDigit(p.data[p.off+2]) && p.data[p.off+3] == ':' {
+		p.off++
+		for !p.eof() && strings.IndexByte("0123456789+-.:Zz", p.data[p.off]) >= 0 {
+			p.off++
+		}
+	}
+	tok := string(p.data[start:p.off])
+	if isTOMLDatetime(tok) {
+		return tomlDatetime(tok), nil
+	}
+
+	switch tok {
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan", "+nan", "-nan":
+		return math.NaN(), nil
+	}
+	if err := checkUnderscores(tok); err != nil {
+		return nil, p.errorf(start, "invalid number %q: %v", tok, err)
+	}
+	digits := strings.ReplaceAll(tok, "_", "")
+	unsigned := strings.TrimLeft(digits, "+-")
+	if len(unsigned) > 1 && unsigned[0] == '0' && (unsigned[1] == 'x' || unsigned[1] == 'o' || unsigned[1] == 'b') {
+		if unsigned != digits {
+			return nil, p.errorf(start, "invalid number %q: sign not allowed on %s integer", tok, unsigned[:2])
+		}
+		base := map[byte]int{'x': 16, 'o': 8, 'b': 2}[unsigned[1]]
+		n, err := strconv.ParseInt(unsigned[2:], base, 64)
+		if err != nil || unsigned[2:] == "" {
+			return nil, p.errorf(start, "invalid number %q", tok)
+		}
+		return n, nil
+	}
+	if strings.ContainsAny(unsigned, ".eE") {
+		if !isTOMLFloat(unsigned) {
+			return nil, p.errorf(start, "invalid float %q", tok)
+		}
+		f, err := strconv.ParseFloat(digits, 64)
+		if err != nil {
+			return nil, p.errorf(start, "invalid float %q", tok)
+		}
+		return f, nil
+	}
+	if unsigned == "" || strings.Trim(unsigned, "0123456789") != "" {
+		return nil, p.errorf(start, "invalid value %q", tok)
+	}
+	if len(unsigned) > 1 && unsigned[0] == '0' {
+		return nil, p.errorf(start, "invalid number %q: leading zeros are not allowed", tok)
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return nil, p.errorf(start, "integer %q out of range", tok)
+	}
+	return n, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// checkUnderscores 检查数字中的下划线两侧都是数字
+func checkUnderscores(tok string) error {
+	for i := 0; i < len(tok); i++ {
+		if tok[i] != '_' {
+			continue
+		}
+		if i == 0 || i == len(tok)-1 || !isHexDigit(tok[i-1]) || !isHexDigit(tok[i+1]) {
+			return fmt.Errorf("underscores must be between digits")
+		}
+	}
+	return nil
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// isTOMLFloat 检查浮点数格式：小数点两侧必须有数字，指数部分必须有数字
+func isTOMLFloat(s string) bool {
+	mantissa, exp := s, ""
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		mantissa, exp = s[:i], strings.TrimLeft(s[i+1:], "+-")
+		if exp == "" || strings.Trim(exp, "0123456789") != "" {
+			return false
+		}
+	}
+	intPart, frac := mantissa, ""
+	hasDot := false
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		intPart, frac, hasDot = mantissa[:i], mantissa[i+1:], true
+	}
+	if intPart == "" || strings.Trim(intPart, "0123456789") != "" {
+		return false
+	}
+	if len(intPart) > 1 && intPart[0] == '0' {
+		return false
+	}
+	if hasDot && (frac == "" || strings.Trim(frac, "0123456789") != "") {
+		return false
+	}
+	return true
+}
+
+// TOML 支持的日期时间格式
+var tomlDatetimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+	"15:04:05.999999999",
+}
+
+// isTOMLDatetime 判断文本是否为合法的 TOML 日期时间
+func isTOMLDatetime(tok string) bool {
+	if len(tok) < 8 || !(tok[4] == '-' || tok[2] == ':') {
+		return false
+	}
+	s := tok
+	if len(s) > 10 && (s[10] == ' ' || s[10] == 't') {
+		s = s[:10] + "T" + s[11:]
+	}
+	s = strings.Replace(s, "z", "Z", 1)
+	for _, layout := range tomlDatetimeLayouts {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteTOMLString 把字符串写成 TOML 字符串：含有反斜杠或双引号且不含单引号时使用字面量字符串，
+// 以保持 Windows 路径等内容可读，否则使用带转义的基本字符串
+func quoteTOMLString(s string) string {
+	if strings.ContainsAny(s, "\\\"") && !strings.ContainsAny(s, "'") && !hasControlChar(s) {
+		return "'" + s + "'"
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7F {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func hasControlChar(s string) bool {
+	for _, r := range s {
+		if (r < 0x20 && r != '\t') || r == 0x7F {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteTOMLKey 返回键在 TOML 中的写法，非裸键加引号
+func quoteTOMLKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for i := 0; i < len(key); i++ {
+		if !isBareKeyChar(key[i]) {
+			return quoteTOMLString(key)
+		}
+	}
+	return key
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 配置结构体通过 toml 标签声明键名，例如 `toml:"startTimeout,omitempty"`：
+// 读取时同时接受驼峰和下划线两种写法，写出时使用标签中的名称，omitempty 的字段为零值时不写出。
+// 结构体可以实现 tomlDefaulter 提供默认值（例如引用了模板的应用），此时只写出与默认值不同的字段，
+// 读取时由调用方先填入默认值再在其上解码。
+
+var appArgsType = reflect.TypeOf(AppArgs{})
+
+// tomlField 描述结构体字段与 TOML 键的对应关系
+type tomlField struct {
+	index     int
+	name      string
+	omitempty bool
+}
+
+// tomlDefaulter 由带有默认值的结构体实现
+type tomlDefaulter interface {
+	tomlDefaults() (interface{}, bool)
+}
+
+// tomlDefaultsOf 返回结构体的默认值，没有默认值时返回无效的 reflect.Value
+func tomlDefaultsOf(v reflect.Value) reflect.Value {
+	if v.CanInterface() {
+		if d, ok := v.Interface().(tomlDefaulter); ok {
+			if def, ok := d.tomlDefaults(); ok {
+				return reflect.ValueOf(def)
+			}
+		}
+	}
+	return reflect.Value{}
+}
+
+// tomlFieldDefault 返回默认值 def 中对应的字段，def 无效时返回无效的 reflect.Value
+func tomlFieldDefault(def reflect.Value, f tomlField) reflect.Value {
+	if !def.IsValid() {
+		return def
+	}
+	return def.Field(f.index)
+}
+
+// tomlOmit 判断字段是否不写出：值为 nil 的子表不写出；有默认值时与默认值相同的字段不写出，
+// 否则 omitempty 的字段为零值时不写出
+func tomlOmit(f tomlField, fv, def reflect.Value) bool {
+	if tomlKind(fv) == "table" && (fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Map) && fv.IsNil() {
+		return true
+	}
+	if def.IsValid() {
+		return reflect.DeepEqual(fv.Interface(), def.Interface())
+	}
+	return f.omitempty && tomlIsEmpty(fv)
+}
+
+// tomlFields 返回结构体中带 toml 标签的字段
+func tomlFields(t reflect.Type) []tomlField {
+	var fields []tomlField
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("toml")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		f := tomlField{index: i, name: parts[0]}
+		for _, opt := range parts[1:] {
+			if opt == "omitempty" {
+				f.omitempty = true
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// snakeCase 把驼峰键名转为下划线写法，例如 appPath -> app_path
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// tomlDecoder 把解析后的 tomlTable 解码到结构体
+type tomlDecoder struct {
+	data []byte
+	warn func(line int, key string) // 遇到未知配置项时调用
+
+	lines map[string]int // 字段路径（例如 apps[0].port）对应的行号，为 nil 时不记录
+}
+
+// decodeTOML 把 TOML 文本解码到 v 指向的结构体，lines 不为 nil 时记录字段路径所在的行号
+func decodeTOML(data []byte, v interface{}, lines map[string]int, warn func(line int, key string)) error {
+	doc, err := parseTOML(data)
+	if err != nil {
+		return err
+	}
+	d := &tomlDecoder{data: data, lines: lines, warn: warn}
+	return d.decodeTable(doc, reflect.ValueOf(v).Elem(), "")
+}
+
+// record 记录字段路径所在的行号
+func (d *tomlDecoder) record(path string, off int) {
+	if d.lines == nil {
+		return
+	}
+	line, _ := tomlPosition(d.data, off)
+	d.lines[path] = line
+}
+
+func (d *tomlDecoder) errorf(off int, format string, args ...interface{}) error {
+	line, col := tomlPosition(d.data, off)
+	return &TOMLError{Line: line, Col: col, Msg: fmt.Sprintf(format, args...)}
+}
+
+// decodeTable 把表中的键写入结构体 v 的对应字段，path 用于错误信息
+func (d *tomlDecoder) decodeTable(t *tomlTable, v reflect.Value, path string) error {
+	byName := map[string]tomlField{}
+	for _, f := range tomlFields(v.Type()) {
+		byName[f.name] = f
+		byName[snakeCase(f.name)] = f
+	}
+	for _, key := range t.keys {
+		full := key
+		if path != "" {
+			full = path + "." + key
+		}
+		f, ok := byName[key]
+		if !ok {
+			if d.warn != nil {
+				line, _ := tomlPosition(d.data, t.pos[key])
+				d.warn(line, full)
+			}
+			continue
+		}
+		d.record(joinTOMLPath(path, f.name), t.pos[key])
+		if err := d.decodeValue(t.values[key], v.Field(f.index), full, t.pos[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeValue 把一个 TOML 值写入字段
+func (d *tomlDecoder) decodeValue(val interface{}, v reflect.Value, path string, off int) error {
+	if v.Type() == appArgsType {
+		switch x := val.(type) {
+		case string:
+			v.Set(reflect.ValueOf(AppArgs{Line: x}))
+			return nil
+		case []interface{}:
+			list, err := d.stringList(x, path, off)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(AppArgs{List: list, Array: true}))
+			return nil
+		}
+		return d.errorf(off, "%s: expected string or array of strings, found %s", path, tomlTypeName(val))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		s, ok := val.(string)
+		if !ok {
+			return d.errorf(off, "%s: expected string, found %s", path, tomlTypeName(val))
+		}
+		v.SetString(s)
+	case reflect.Int:
+		switch x := val.(type) {
+		case int64:
+			v.SetInt(x)
+		case string:
+			// 兼容旧版本写出的带引号的数字
+			n, err := strconv.Atoi(strings.TrimSpace(x))
+			if err != nil {
+				return d.errorf(off, "%s: expected integer, found string %q", path, x)
+			}
+			v.SetInt(int64(n))
+		default:
+			return d.errorf(off, "%s: expected integer, found %s", path, tomlTypeName(val))
+		}
+	case reflect.Bool:
+		b, err := d.boolValue(val, path, off)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Ptr:
+		// 已有默认值的指针在原对象上解码，保留未出现的键的默认值
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decodeValue(val, v.Elem(), path, off)
+	case reflect.Struct:
+		t, ok := val.(*tomlTable)
+		if !ok {
+			return d.errorf(off, "%s: expected table, found %s", path, tomlTypeName(val))
+		}
+		return d.decodeTable(t, v, path)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			arr, ok := val.([]interface{})
+			if !ok {
+				return d.errorf(off, "%s: expected array of strings, found %s", path, tomlTypeName(val))
+			}
+			list, err := d.stringList(arr, path, off)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(list))
+			return nil
+		}
+		var tables []*tomlTable
+		switch x := val.(type) {
+		case *tomlArrayOfTables:
+			tables = x.tables
+		case []interface{}:
+			// 内联表数组，例如 apps = [{ name = "a" }]
+			for _, item := range x {
+				t, ok := item.(*tomlTable)
+				if !ok {
+					return d.errorf(off, "%s: expected array of tables, found %s in array", path, tomlTypeName(item))
+				}
+				tables = append(tables, t)
+			}
+		default:
+			return d.errorf(off, "%s: expected array of tables, found %s", path, tomlTypeName(val))
+		}
+		slice := reflect.MakeSlice(v.Type(), len(tables), len(tables))
+		for i, t := range tables {
+			d.record(fmt.Sprintf("%s[%d]", path, i), t.start)
+			if err := d.decodeTable(t, slice.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Map:
+		t, ok := val.(*tomlTable)
+		if !ok {
+			return d.errorf(off, "%s: expected table, found %s", path, tomlTypeName(val))
+		}
+		// 已有的 map（叠加 profile 时）在原对象上合并
+		m := v
+		if m.IsNil() {
+			m = reflect.MakeMap(v.Type())
+		}
+		if v.Type().Elem().Kind() == reflect.Struct {
+			// [templates.x] 等以结构体为值的 map，已有的元素在原值上合并
+			for _, key := range t.keys {
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if old := m.MapIndex(reflect.ValueOf(key)); old.IsValid() {
+					elem.Set(old)
+				}
+				if err := d.decodeValue(t.values[key], elem, path+"."+key, t.pos[key]); err != nil {
+					return err
+				}
+				m.SetMapIndex(reflect.ValueOf(key), elem)
+			}
+			v.Set(m)
+			return nil
+		}
+		for _, key := range t.keys {
+			var s string
+			switch x := t.values[key].(type) {
+			case string:
+				s = x
+			case int64, bool, float64:
+				// 环境变量等字符串表允许直接写数字和布尔值
+				s = fmt.Sprint(x)
+			default:
+				return d.errorf(t.pos[key], "%s.%s: expected string, found %s", path, key, tomlTypeName(x))
+			}
+			m.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(s))
+		}
+		v.Set(m)
+	default:
+		return d.errorf(off, "%s: unsupported field type %s", path, v.Type())
+	}
+	return nil
+}
+
+func (d *tomlDecoder) boolValue(val interface{}, path string, off int) (bool, error) {
+	switch x := val.(type) {
+	case bool:
+		return x, nil
+	case string:
+		// 兼容旧版本接受的 "true"/"1" 等写法
+		switch x {
+		case "true", "True", "TRUE", "1":
+			return true, nil
+		case "false", "False", "FALSE", "0":
+			return false, nil
+		}
+		return false, d.errorf(off, "%s: expected boolean, found string %q", path, x)
+	}
+	return false, d.errorf(off, "%s: expected boolean, found %s", path, tomlTypeName(val))
+}
+
+func (d *tomlDecoder) stringList(arr []interface{}, path string, off int) ([]string, error) {
+	list := make([]string, 0, len(arr))
+	for i, item := range arr {
+		s, ok := item.(string)
+		if !ok {
+			return nil, d.errorf(off, "%s[%d]: expected string, found %s", path, i, tomlTypeName(item))
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// tomlTypeName 返回值在错误信息中的类型名
+func tomlTypeName(val interface{}) string {
+	switch val.(type) {
+	case string:
+		return "string"
+	case int64:
+		return "integer"
+	case float64:
+		return "float"
+	case bool:
+		return "boolean"
+	case tomlDatetime:
+		return "datetime"
+	case []interface{}:
+		return "array"
+	case *tomlTable:
+		return "table"
+	case *tomlArrayOfTables:
+		return "array of tables"
+	}
+	return fmt.Sprintf("%T", val)
+}
+
+// encodeTOML 把带 toml 标签的结构体写成 TOML 文本：先写标量，再写子表，最后写表数组
+func encodeTOML(v interface{}) string {
+	var b strings.Builder
+	encodeTOMLTable(&b, reflect.ValueOf(v), "", reflect.Value{})
+	return strings.TrimLeft(b.String(), "\n")
+}
+
+// encodeTOMLTable 写出结构体的字段，def 是默认值（无效时使用结构体自身提供的默认值）
+func encodeTOMLTable(b *strings.Builder, v reflect.Value, path string, def reflect.Value) {
+	if !def.IsValid() {
+		def = tomlDefaultsOf(v)
+	}
+	fields := tomlFields(v.Type())
+	var tables, arrays []tomlField
+	for _, f := range fields {
+		fv := v.Field(f.index)
+		if tomlOmit(f, fv, tomlFieldDefault(def, f)) {
+			continue
+		}
+		switch tomlKind(fv) {
+		case "table":
+			tables = append(tables, f)
+		case "array":
+			arrays = append(arrays, f)
+		default:
+			fmt.Fprintf(b, "%s = %s\n", quoteTOMLKey(f.name), encodeTOMLValue(fv))
+		}
+	}
+
+	for _, f := range tables {
+		encodeTOMLSubTable(b, v.Field(f.index), joinTOMLPath(path, f.name), tomlFieldDefault(def, f))
+	}
+
+	for _, f := range arrays {
+		fv := v.Field(f.index)
+		name := joinTOMLPath(path, f.name)
+		for i := 0; i < fv.Len(); i++ {
+			encodeTOMLArrayTable(b, fv.Index(i), name)
+		}
+	}
+}
+
+// encodeTOMLSubTable 写出 [name] 子表，v 为结构体、结构体指针或 map[string]string，nil 时不写
+func encodeTOMLSubTable(b *strings.Builder, v reflect.Value, name string, def reflect.Value) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Map && v.IsNil() {
+		return
+	}
+	if def.IsValid() && (def.Kind() == reflect.Ptr || def.Kind() == reflect.Map) && def.IsNil() {
+		def = reflect.Value{}
+	} else if def.IsValid() && def.Kind() == reflect.Ptr {
+		def = def.Elem()
+	}
+	if v.Kind() == reflect.Map && v.Type().Elem().Kind() == reflect.Struct {
+		// 以结构体为值的 map（例如 [templates.x]）写成一组子表
+		for _, k := range sortedMapKeys(v) {
+			encodeTOMLSubTable(b, v.MapIndex(reflect.ValueOf(k)), joinTOMLPath(name, k), reflect.Value{})
+		}
+		return
+	}
+	fmt.Fprintf(b, "\n[%s]\n", name)
+	if v.Kind() == reflect.Map {
+		for _, k := range sortedMapKeys(v) {
+			val := v.MapIndex(reflect.ValueOf(k))
+			if def.IsValid() {
+				if dv := def.MapIndex(reflect.ValueOf(k)); dv.IsValid() && dv.String() == val.String() {
+					continue
+				}
+			}
+			fmt.Fprintf(b, "%s = %s\n", quoteTOMLKey(k), quoteTOMLString(val.String()))
+		}
+		return
+	}
+	encodeTOMLTable(b, v, name, def)
+}
+
+// encodeTOMLArrayTable 写出表数组中的一个 [[name]] 表
+func encodeTOMLArrayTable(b *strings.Builder, v reflect.Value, name string) {
+	fmt.Fprintf(b, "\n[[%s]]\n", name)
+	encodeTOMLTable(b, v, name, reflect.Value{})
+}
+
+// sortedMapKeys 返回 map[string]string 排序后的键
+func sortedMapKeys(v reflect.Value) []string {
+	keys := make([]string, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinTOMLPath(path, name string) string {
+	if path == "" {
+		return quoteTOMLKey(name)
+	}
+	return path + "." + quoteTOMLKey(name)
+}
+
+// tomlKind 判断字段写成标量（value）、子表（table）还是表数组（array）
+func tomlKind(v reflect.Value) string {
+	t := v.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == appArgsType:
+		return "value"
+	case t.Kind() == reflect.Struct || t.Kind() == reflect.Map:
+		return "table"
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Struct:
+		return "array"
+	}
+	return "value"
+}
+
+// tomlIsEmpty 判断 omitempty 字段是否为零值
+func tomlIsEmpty(v reflect.Value) bool {
+	if v.Type() == appArgsType {
+		args := v.Interface().(AppArgs)
+		return !args.Array && args.Line == ""
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map:
+		return v.IsNil()
+	case reflect.Slice:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// encodeTOMLValue 把标量或字符串数组写成 TOML 值
+func encodeTOMLValue(v reflect.Value) string {
+	if v.Type() == appArgsType {
+		return v.Interface().(AppArgs).TOML()
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		return encodeTOMLValue(v.Elem())
+	case reflect.String:
+		return quoteTOMLString(v.String())
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Float64:
+		f := v.Float()
+		switch {
+		case math.IsInf(f, 1):
+			return "inf"
+		case math.IsInf(f, -1):
+			return "-inf"
+		case math.IsNaN(f):
+			return "nan"
+		}
+		s := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEn") {
+			s += ".0"
+		}
+		return s
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = encodeTOMLValue(v.Index(i))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return quoteTOMLString(fmt.Sprint(v.Interface()))
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestTOMLRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"minimal", Config{UIPort: 8080, Apps: []AppConfig{{Name: "web", Execute: "/usr/bin/web"}}}},
+		{"full app", Config{
+			UIPort: 8080,
+			Apps: []AppConfig{{
+				Name:                  "api",
+				Execute:               "java",
+				AppPath:               "/opt/api/app.jar",
+				AppType:               "java",
+				Args:                  AppArgs{List: []string{"-Xmx512m", "--name", "my app"}, Array: true},
+				Autostart:             true,
+				Port:                  9000,
+				StopSignal:            "SIGINT",
+				KillMode:              "process",
+				Restart:               "on-failure",
+				MaxRetries:            5,
+				DependsOn:             []string{"db"},
+				RestartOnConfigChange: boolPtr(false),
+				WorkDir:               "/opt/api",
+				Env:                   map[string]string{"MODE": "prod", "QUOTE": `say "hi"`},
+				InheritEnv:            boolPtr(true),
+				Healthcheck:           &HealthCheck{Type: "http", URL: "http://127.0.0.1:9000/health", ExpectStatus: 200},
+			}, {
+				Name:    "db",
+				Execute: "/usr/bin/db",
+				Args:    AppArgs{Line: `--data "/var/lib/db" -v`},
+				Shell:   true,
+			}},
+		}},
+		{"user, logs and include", Config{
+			UIPort:  9090,
+			Include: []string{"conf.d/*.toml"},
+			Apps:    []AppConfig{{Name: "a", Execute: "a", Logs: &LogConfig{Compress: boolPtr(true)}}},
+			User:    &UserConfig{Username: "admin", PasswordHash: "abc"},
+		}},
+		{"templates", Config{
+			UIPort: 8080,
+			Apps:   []AppConfig{{Name: "svc", Template: "springboot", Execute: "java", AppPath: "svc.jar"}},
+			Templates: map[string]AppConfig{
+				"springboot": {Execute: "java", Env: map[string]string{"JAVA_OPTS": "-Xmx1g"}},
+			},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := encodeTOML(tt.cfg)
+			var got Config
+			if err := decodeTOML([]byte(text), &got, nil, nil); err != nil {
+				t.Fatalf("decodeTOML(encodeTOML()): %v\n%s", err, text)
+			}
+			if !reflect.DeepEqual(got, tt.cfg) {
+				t.Errorf("round trip mismatch\n got: %#v\nwant: %#v\nTOML:\n%s", got, tt.cfg, text)
+			}
+		})
+	}
+}
+
+func TestDecodeTOMLQuotedIntegers(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    int
+		wantErr string
+	}{
+		{"integer", "uiPort = 8080", 8080, ""},
+		{"quoted integer", `uiPort = "8080"`, 8080, ""},
+		{"quoted integer with spaces", `uiPort = " 8080 "`, 8080, ""},
+		{"quoted non-integer", `uiPort = "http"`, 0, `line 1, column 10: uiPort: expected integer, found string "http"`},
+		{"float", "uiPort = 80.5", 0, "line 1, column 10: uiPort: expected integer, found float"},
+		{"bool", "uiPort = true", 0, "line 1, column 10: uiPort: expected integer, found boolean"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			err := decodeTOML([]byte(tt.input), &cfg, nil, nil)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("decodeTOML(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeTOML(%q): %v", tt.input, err)
+			}
+			if cfg.UIPort != tt.want {
+				t.Errorf("decodeTOML(%q) uiPort = %d, want %d", tt.input, cfg.UIPort, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeTOMLFields(t *testing.T) {
+	input := `ui_port = 8080
+unknown = 1
+
+[[apps]]
+name = "web"
+app_path = "/srv/web"
+args = ["-p", "80"]
+
+[apps.env]
+PORT = 80
+DEBUG = true
+`
+	var cfg Config
+	lines := map[string]int{}
+	var warnings []string
+	warn := func(line int, key string) {
+		warnings = append(warnings, key)
+	}
+	if err := decodeTOML([]byte(input), &cfg, lines, warn); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.UIPort != 8080 || cfg.Apps[0].AppPath != "/srv/web" {
+		t.Errorf("snake_case keys not decoded: %+v", cfg)
+	}
+	if want := (AppArgs{List: []string{"-p", "80"}, Array: true}); !reflect.DeepEqual(cfg.Apps[0].Args, want) {
+		t.Errorf("args = %#v, want %#v", cfg.Apps[0].Args, want)
+	}
+	if want := map[string]string{"PORT": "80", "DEBUG": "true"}; !reflect.DeepEqual(cfg.Apps[0].Env, want) {
+		t.Errorf("env = %v, want %v", cfg.Apps[0].Env, want)
+	}
+	if want := []string{"unknown"}; !reflect.DeepEqual(warnings, want) {
+		t.Errorf("warnings = %v, want %v", warnings, want)
+	}
+	if lines["apps[0].appPath"] != 6 || lines["apps[0]"] != 4 {
+		t.Errorf("lines = %v", lines)
+	}
+}
+
+func TestDecodeTOMLTypeErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"[[apps]]\nname = 1", "line 2, column 8: apps[0].name: expected string, found integer"},
+		{"[[apps]]\nargs = [1]", "apps[0].args"},
+		{"apps = 1", "line 1, column 8: apps: expected array of tables, found integer"},
+		{"[[apps]]\ndaemon = \"maybe\"", "apps[0].daemon"},
+		{"[[apps]]\n[apps.env]\nX = [1]", "line 3, column 5: apps[0].env.X: expected string, found array"},
+	}
+	for _, tt := range tests {
+		var cfg Config
+		err := decodeTOML([]byte(tt.input), &cfg, nil, nil)
+		var tomlErr *TOMLError
+		if !errors.As(err, &tomlErr) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("decodeTOML(%q) error = %v, want %q", tt.input, err, tt.want)
+		}
+	}
+}
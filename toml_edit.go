@@ -0,0 +1,513 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// errTOMLEdit 表示文档使用了无法原地修改的写法（例如点分键定义的子表、内联的表数组），
+// 调用方应重新生成整个文档
+var errTOMLEdit = errors.New("document cannot be edited in place")
+
+// tomlEdit 是对原文档的一处修改：把 [start, end) 替换为 text，start == end 时为插入
+type tomlEdit struct {
+	start, end int
+	text       string
+	block      bool // 插入的是子表，同一位置插入的键排在子表之前，避免新键落入子表
+}
+
+// tomlEditor 把带 toml 标签的结构体写入已有的 TOML 文档，只改动值发生变化的键，
+// 保留注释、空行、键的顺序、值的原有写法以及未知的配置项
+type tomlEditor struct {
+	data    []byte
+	headers []int // 所有表头的起始偏移
+	edits   []tomlEdit
+}
+
+// editTOML 把 v 写入 TOML 文档 data，返回修改后的文档
+func editTOML(data []byte, v interface{}) ([]byte, error) {
+	root, headers, err := parseTOMLDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	e := &tomlEditor{data: data, headers: headers}
+	if err := e.editTable(root, reflect.ValueOf(v), "", e.keysEnd(root), len(data), reflect.Value{}); err != nil {
+		return nil, err
+	}
+	return e.apply()
+}
+
+// apply 按位置顺序执行所有修改
+func (e *tomlEditor) apply() ([]byte, error) {
+	sort.SliceStable(e.edits, func(i, j int) bool {
+		a, b := e.edits[i], e.edits[j]
+		if a.start != b.start {
+			return a.start < b.start
+		}
+		return !a.block && b.block
+	})
+	var b strings.Builder
+	cursor := 0
+	for _, ed := range e.edits {
+		if ed.start < cursor {
+			// 插入位置落在被删除的范围内时，改为插入到删除范围之后
+			if ed.start != ed.end {
+				return nil, errTOMLEdit
+			}
+			ed.start, ed.end = cursor, cursor
+		}
+		b.Write(e.data[cursor:ed.start])
+		text := ed.text
+		if ed.start == ed.end {
+			out := b.String()
+			// 插入总是从新的一行开始；子表之前已经有空行（或位于文件开头）时不再加空行
+			if out != "" && !strings.HasSuffix(out, "\n") {
+				text = "\n" + text
+			} else if ed.block && (out == "" || strings.HasSuffix(out, "\n\n")) {
+				text = strings.TrimPrefix(text, "\n")
+			}
+		}
+		b.WriteString(text)
+		cursor = ed.end
+	}
+	b.Write(e.data[cursor:])
+	out := b.String()
+	// 删除文件末尾的子表后不留下多余的空行
+	for strings.HasSuffix(out, "\n\n") && !strings.HasSuffix(string(e.data), "\n\n") {
+		out = out[:len(out)-1]
+	}
+	return []byte(out), nil
+}
+
+func (e *tomlEditor) replace(start, end int, text string) {
+	e.edits = append(e.edits, tomlEdit{start: start, end: end, text: text})
+}
+
+// insert 在 off 处插入文本，block 表示插入的是子表
+func (e *tomlEditor) insert(off int, text string, block bool) {
+	e.edits = append(e.edits, tomlEdit{start: off, end: off, text: text, block: block})
+}
+
+// editTable 修改表 t 中结构体 v 对应的键。keysEnd 是新键插入的位置，regionEnd 是新子表插入的位置，
+// def 是默认值（无效时使用结构体自身提供的默认值）。
+func (e *tomlEditor) editTable(t *tomlTable, v reflect.Value, path string, keysEnd, regionEnd int, def reflect.Value) error {
+	if !def.IsValid() {
+		def = tomlDefaultsOf(v)
+	}
+	for _, f := range tomlFields(v.Type()) {
+		fv := v.Field(f.index)
+		fdef := tomlFieldDefault(def, f)
+		key, exists := lookupTOMLKey(t, f.name)
+		kind := tomlKind(fv)
+		absent := tomlOmit(f, fv, fdef)
+		name := joinTOMLPath(path, f.name)
+
+		if !exists {
+			// 缺少的键解码为零值（有默认值时为默认值），值相同时不必写出
+			if absent || (!def.IsValid() && kind == "value" && fv.IsZero()) {
+				continue
+			}
+			var b strings.Builder
+			switch kind {
+			case "table":
+				encodeTOMLSubTable(&b, fv, name, fdef)
+				e.insert(e.contentEnd(regionEnd), b.String(), true)
+			case "array":
+				for i := 0; i < fv.Len(); i++ {
+					encodeTOMLArrayTable(&b, fv.Index(i), name)
+				}
+				e.insert(e.contentEnd(regionEnd), b.String(), true)
+			default:
+				e.insert(keysEnd, fmt.Sprintf("%s = %s\n", quoteTOMLKey(f.name), encodeTOMLValue(fv)), false)
+			}
+			continue
+		}
+
+		val := t.values[key]
+		switch x := val.(type) {
+		case *tomlTable:
+			if kind != "table" {
+				return errTOMLEdit
+			}
+			if err := e.editSubTable(t, key, x, fv, name, absent, fdef); err != nil {
+				return err
+			}
+		case *tomlArrayOfTables:
+			if kind != "array" {
+				return errTOMLEdit
+			}
+			if err := e.editArrayOfTables(x, fv, name, regionEnd); err != nil {
+				return err
+			}
+		default:
+			// 值没有变化的键保持原样，即使它与默认值相同
+			if e.equal(val, fv, t.pos[key]) {
+				continue
+			}
+			if absent {
+				e.deleteKey(t, key)
+				continue
+			}
+			if kind != "value" {
+				// 内联的表数组等写法
+				return errTOMLEdit
+			}
+			e.replace(t.pos[key], t.end[key], encodeTOMLValue(fv))
+		}
+	}
+	return nil
+}
+
+// editSubTable 修改结构体或 map 对应的子表，def 是子表的默认值
+func (e *tomlEditor) editSubTable(parent *tomlTable, key string, t *tomlTable, fv reflect.Value, name string, absent bool, def reflect.Value) error {
+	if def.IsValid() && (def.Kind() == reflect.Ptr || def.Kind() == reflect.Map) && def.IsNil() {
+		def = reflect.Value{}
+	} else if def.IsValid() && def.Kind() == reflect.Ptr {
+		def = def.Elem()
+	}
+	if !t.inline && !absent && fv.Kind() == reflect.Map && fv.Type().Elem().Kind() == reflect.Struct {
+		return e.editTableMap(t, fv, name)
+	}
+	switch {
+	case t.inline:
+		if absent {
+			e.deleteKey(parent, key)
+		} else if !e.equal(t, fv, parent.pos[key]) {
+			e.replace(parent.pos[key], parent.end[key], encodeTOMLInline(fv))
+		}
+		return nil
+	case !t.explicit:
+		// 点分键或隐式定义的表，内容没有变化时保持原样
+		if !absent && e.equal(t, fv, parent.pos[key]) {
+			return nil
+		}
+		return errTOMLEdit
+	case absent:
+		if fv.Kind() != reflect.Ptr && fv.Kind() != reflect.Map || !fv.IsNil() {
+			if e.equal(t, fv, parent.pos[key]) {
+				return nil
+			}
+		}
+		return e.deleteRegion(t)
+	}
+
+	if fv.Kind() == reflect.Ptr {
+		fv = fv.Elem()
+	}
+	if fv.Kind() == reflect.Struct {
+		return e.editTable(t, fv, name, e.keysEnd(t), e.regionEnd(t), def)
+	}
+
+	// map[string]string：逐个键比较，与默认值相同的键不写出
+	inherited := func(k string, mv reflect.Value) bool {
+		if !def.IsValid() {
+			return false
+		}
+		dv := def.MapIndex(reflect.ValueOf(k))
+		return dv.IsValid() && dv.String() == mv.String()
+	}
+	for _, k := range t.keys {
+		if mv := fv.MapIndex(reflect.ValueOf(k)); !mv.IsValid() || inherited(k, mv) {
+			if _, ok := t.values[k].(*tomlTable); ok {
+				return errTOMLEdit
+			}
+			e.deleteKey(t, k)
+		}
+	}
+	var added strings.Builder
+	for _, k := range sortedMapKeys(fv) {
+		mv := fv.MapIndex(reflect.ValueOf(k))
+		if inherited(k, mv) {
+			continue
+		}
+		val, ok := t.values[k]
+		if !ok {
+			fmt.Fprintf(&added, "%s = %s\n", quoteTOMLKey(k), quoteTOMLString(mv.String()))
+			continue
+		}
+		if _, isTable := val.(*tomlTable); isTable {
+			return errTOMLEdit
+		}
+		if !e.equal(val, mv, t.pos[k]) {
+			e.replace(t.pos[k], t.end[k], quoteTOMLString(mv.String()))
+		}
+	}
+	if added.Len() > 0 {
+		e.insert(e.keysEnd(t), added.String(), false)
+	}
+	return nil
+}
+
+// editTableMap 修改以结构体为值的 map 对应的一组子表（例如 [templates.x]）：删除不再存在的子表，
+// 修改已有的子表，在最后一个子表之后追加新的子表。上级表可以没有表头。
+func (e *tomlEditor) editTableMap(t *tomlTable, fv reflect.Value, name string) error {
+	appendAt := -1
+	if t.explicit {
+		appendAt = e.contentEnd(e.regionEnd(t))
+	}
+	for _, k := range t.keys {
+		sub, ok := t.values[k].(*tomlTable)
+		if !ok || !sub.explicit {
+			return errTOMLEdit
+		}
+		if !t.explicit {
+			appendAt = max(appendAt, e.contentEnd(e.regionEnd(sub)))
+		}
+		if !fv.MapIndex(reflect.ValueOf(k)).IsValid() {
+			if err := e.deleteRegion(sub); err != nil {
+				return err
+			}
+		}
+	}
+	if appendAt < 0 {
+		return errTOMLEdit
+	}
+	var added strings.Builder
+	for _, k := range sortedMapKeys(fv) {
+		mv := fv.MapIndex(reflect.ValueOf(k))
+		sub := joinTOMLPath(name, k)
+		if st, ok := t.values[k].(*tomlTable); ok {
+			if err := e.editTable(st, mv, sub, e.keysEnd(st), e.regionEnd(st), reflect.Value{}); err != nil {
+				return err
+			}
+			continue
+		}
+		encodeTOMLSubTable(&added, mv, sub, reflect.Value{})
+	}
+	if added.Len() > 0 {
+		e.insert(appendAt, added.String(), true)
+	}
+	return nil
+}
+
+// editArrayOfTables 按 name 键匹配表数组中的元素：删除不再存在的元素，修改已有的元素，
+// 在最后一个元素之后追加新元素
+func (e *tomlEditor) editArrayOfTables(arr *tomlArrayOfTables, fv reflect.Value, name string, regionEnd int) error {
+	nameField := -1
+	for _, f := range tomlFields(fv.Type().Elem()) {
+		if f.name == "name" {
+			nameField = f.index
+		}
+	}
+	if nameField < 0 {
+		return errTOMLEdit
+	}
+
+	existing := map[string]*tomlTable{}
+	for _, t := range arr.tables {
+		n, ok := t.values["name"].(string)
+		if !ok {
+			return errTOMLEdit
+		}
+		if _, dup := existing[n]; dup {
+			return errTOMLEdit
+		}
+		existing[n] = t
+	}
+	wanted := map[string]bool{}
+	for i := 0; i < fv.Len(); i++ {
+		wanted[fv.Index(i).Field(nameField).String()] = true
+	}
+
+	appendAt := e.contentEnd(regionEnd)
+	if len(arr.tables) > 0 {
+		appendAt = e.contentEnd(e.regionEnd(arr.tables[len(arr.tables)-1]))
+	}
+	for _, t := range arr.tables {
+		if !wanted[t.values["name"].(string)] {
+			if err := e.deleteRegion(t); err != nil {
+				return err
+			}
+		}
+	}
+	var added strings.Builder
+	for i := 0; i < fv.Len(); i++ {
+		item := fv.Index(i)
+		t, ok := existing[item.Field(nameField).String()]
+		if !ok {
+			encodeTOMLArrayTable(&added, item, name)
+			continue
+		}
+		if err := e.editTable(t, item, name, e.keysEnd(t), e.regionEnd(t), reflect.Value{}); err != nil {
+			return err
+		}
+	}
+	if added.Len() > 0 {
+		e.insert(appendAt, added.String(), true)
+	}
+	return nil
+}
+
+// equal 判断文档中的值解码后是否与 fv 相同
+func (e *tomlEditor) equal(val interface{}, fv reflect.Value, off int) bool {
+	decoded := reflect.New(fv.Type()).Elem()
+	d := &tomlDecoder{data: e.data}
+	if err := d.decodeValue(val, decoded, "", off); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(decoded.Interface(), fv.Interface())
+}
+
+// deleteKey 删除 key = value 所在的整行
+func (e *tomlEditor) deleteKey(t *tomlTable, key string) {
+	e.replace(e.lineStart(t.keyPos[key]), e.lineEnd(t.end[key]), "")
+}
+
+// deleteRegion 删除表头（连同紧挨着的注释）到下一个无关表头之间的内容
+func (e *tomlEditor) deleteRegion(t *tomlTable) error {
+	for _, off := range e.descendants(t) {
+		if off < t.start {
+			return errTOMLEdit
+		}
+	}
+	e.replace(e.commentStart(t.start), e.regionEnd(t), "")
+	return nil
+}
+
+// keysEnd 返回表中最后一个 key = value 行之后的位置，表中没有键时为表头行之后（根表为文件开头）
+func (e *tomlEditor) keysEnd(t *tomlTable) int {
+	end := -1
+	for _, k := range t.keys {
+		if off, ok := t.end[k]; ok && e.lineEnd(off) > end {
+			end = e.lineEnd(off)
+		}
+	}
+	if end >= 0 {
+		return end
+	}
+	if t.explicit {
+		return e.lineEnd(t.start)
+	}
+	return 0
+}
+
+// regionEnd 返回表的范围结束位置：之后第一个不属于该表子表的表头（不含其上方紧挨着的注释）
+func (e *tomlEditor) regionEnd(t *tomlTable) int {
+	inside := map[int]bool{}
+	for _, off := range e.descendants(t) {
+		inside[off] = true
+	}
+	for _, h := range e.headers {
+		if h > t.start && !inside[h] {
+			return e.commentStart(h)
+		}
+	}
+	return len(e.data)
+}
+
+// descendants 返回表中所有由表头定义的子表的表头位置
+func (e *tomlEditor) descendants(t *tomlTable) []int {
+	var offs []int
+	for _, k := range t.keys {
+		switch x := t.values[k].(type) {
+		case *tomlTable:
+			if x.explicit {
+				offs = append(offs, x.start)
+			}
+			offs = append(offs, e.descendants(x)...)
+		case *tomlArrayOfTables:
+			for _, sub := range x.tables {
+				offs = append(offs, sub.start)
+				offs = append(offs, e.descendants(sub)...)
+			}
+		}
+	}
+	return offs
+}
+
+// lineStart 返回 off 所在行的开头
+func (e *tomlEditor) lineStart(off int) int {
+	for off > 0 && e.data[off-1] != '\n' {
+		off--
+	}
+	return off
+}
+
+// lineEnd 返回 off 所在行的换行之后的位置
+func (e *tomlEditor) lineEnd(off int) int {
+	for off < len(e.data) && e.data[off] != '\n' {
+		off++
+	}
+	if off < len(e.data) {
+		off++
+	}
+	return off
+}
+
+// commentStart 返回 off 所在行上方紧挨着的注释行的开头
+func (e *tomlEditor) commentStart(off int) int {
+	start := e.lineStart(off)
+	for start > 0 {
+		prev := e.lineStart(start - 1)
+		if !strings.HasPrefix(strings.TrimSpace(string(e.data[prev:start])), "#") {
+			break
+		}
+		start = prev
+	}
+	return start
+}
+
+// contentEnd 从 off 向前跳过空行，返回最后一个非空行之后的位置
+func (e *tomlEditor) contentEnd(off int) int {
+	for off > 0 {
+		prev := e.lineStart(off - 1)
+		if strings.TrimSpace(string(e.data[prev:off])) != "" {
+			break
+		}
+		off = prev
+	}
+	return off
+}
+
+// lookupTOMLKey 查找字段在表中使用的键名，同时接受驼峰和下划线写法
+func lookupTOMLKey(t *tomlTable, name string) (string, bool) {
+	if _, ok := t.values[name]; ok {
+		return name, true
+	}
+	if snake := snakeCase(name); snake != name {
+		if _, ok := t.values[snake]; ok {
+			return snake, true
+		}
+	}
+	return "", false
+}
+
+// encodeTOMLInline 把结构体、map[string]string 或以结构体为值的 map 写成内联表
+func encodeTOMLInline(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	var items []string
+	if v.Kind() == reflect.Map {
+		for _, k := range sortedMapKeys(v) {
+			mv := v.MapIndex(reflect.ValueOf(k))
+			text := quoteTOMLString(mv.String())
+			if mv.Kind() == reflect.Struct {
+				text = encodeTOMLInline(mv)
+			}
+			items = append(items, quoteTOMLKey(k)+" = "+text)
+		}
+	} else {
+		for _, f := range tomlFields(v.Type()) {
+			fv := v.Field(f.index)
+			if f.omitempty && tomlIsEmpty(fv) {
+				continue
+			}
+			text := encodeTOMLValue(fv)
+			if tomlKind(fv) == "table" {
+				if (fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Map) && fv.IsNil() {
+					continue
+				}
+				text = encodeTOMLInline(fv)
+			}
+			items = append(items, quoteTOMLKey(f.name)+" = "+text)
+		}
+	}
+	if len(items) == 0 {
+		return "{}"
+	}
+	return "{ " + strings.Join(items, ", ") + " }"
+}
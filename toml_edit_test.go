@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+const editTestDoc = `# anyrun 配置
+uiPort = 8080 # 管理端口
+extra = "keep me"
+
+[user]
+username = "admin"
+
+# 第一个应用
+[[apps]]
+name = "web"
+execute = "/usr/bin/web"
+port = 80
+custom = true # 未知配置项
+
+[apps.env]
+MODE = "prod"
+
+# 第二个应用
+[[apps]]
+name = "worker"
+execute = '/usr/bin/worker'
+args = ["--queue", "default"]
+`
+
+func TestEditTOML(t *testing.T) {
+	tests := []struct {
+		name   string
+		doc    string
+		update func(cfg *Config)
+		want   string
+	}{
+		{
+			name:   "unchanged",
+			doc:    editTestDoc,
+			update: func(cfg *Config) {},
+			want:   editTestDoc,
+		},
+		{
+			name: "change values keeps comments and unknown keys",
+			doc:  editTestDoc,
+			update: func(cfg *Config) {
+				cfg.UIPort = 9090
+				cfg.Apps[0].Port = 81
+				cfg.Apps[0].Env["DEBUG"] = "1"
+			},
+			want: `# anyrun 配置
+uiPort = 9090 # 管理端口
+extra = "keep me"
+
+[user]
+username = "admin"
+
+# 第一个应用
+[[apps]]
+name = "web"
+execute = "/usr/bin/web"
+port = 81
+custom = true # 未知配置项
+
+[apps.env]
+MODE = "prod"
+DEBUG = "1"
+
+# 第二个应用
+[[apps]]
+name = "worker"
+execute = '/usr/bin/worker'
+args = ["--queue", "default"]
+`,
+		},
+		{
+			name: "remove app with its comment",
+			doc:  editTestDoc,
+			update: func(cfg *Config) {
+				cfg.Apps = cfg.Apps[:1]
+			},
+			want: `# anyrun 配置
+uiPort = 8080 # 管理端口
+extra = "keep me"
+
+[user]
+username = "admin"
+
+# 第一个应用
+[[apps]]
+name = "web"
+execute = "/usr/bin/web"
+port = 80
+custom = true # 未知配置项
+
+[apps.env]
+MODE = "prod"
+`,
+		},
+		{
+			name: "append app after the last app",
+			doc:  "uiPort = 8080\n\n[[apps]]\nname = \"a\"\nexecute = \"a\"\n\n[logs]\ndir = \"logs\"\n",
+			update: func(cfg *Config) {
+				cfg.Apps = append(cfg.Apps, AppConfig{Name: "b", Execute: "b", Port: 90})
+			},
+			want: "uiPort = 8080\n\n[[apps]]\nname = \"a\"\nexecute = \"a\"\n\n" +
+				"[[apps]]\nname = \"b\"\nexecute = \"b\"\nappPath = \"\"\nappType = \"\"\ndaemon = false\nargs = \"\"\nautostart = false\ntimeout = 0\nport = 90\n\n" +
+				"[logs]\ndir = \"logs\"\n",
+		},
+		{
+			name: "keeps snake_case keys and inline tables",
+			doc:  "ui_port = 8080\n\n[[apps]]\nname = \"a\"\nenv = { A = \"1\" }\n",
+			update: func(cfg *Config) {
+				cfg.UIPort = 8081
+				cfg.Apps[0].Env["A"] = "2"
+			},
+			want: "ui_port = 8081\n\n[[apps]]\nname = \"a\"\nenv = { A = \"2\" }\n",
+		},
+		{
+			name: "keeps args string form",
+			doc:  "[[apps]]\nname = \"a\"\nargs = '-p 80' # 端口\n",
+			update: func(cfg *Config) {
+				cfg.Apps[0].Args = AppArgs{Line: "-p 81"}
+			},
+			want: "[[apps]]\nname = \"a\"\nargs = \"-p 81\" # 端口\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg Config
+			if err := decodeTOML([]byte(tt.doc), &cfg, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+			tt.update(&cfg)
+			got, err := editTOML([]byte(tt.doc), cfg)
+			if err != nil {
+				t.Fatalf("editTOML: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("editTOML() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditTOMLFallback(t *testing.T) {
+	// 内联的表数组无法原地修改，由调用方重新生成整个文件
+	doc := `apps = [{ name = "a" }]`
+	var cfg Config
+	if err := decodeTOML([]byte(doc), &cfg, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Apps = append(cfg.Apps, AppConfig{Name: "b"})
+	if _, err := editTOML([]byte(doc), cfg); !errors.Is(err, errTOMLEdit) {
+		t.Errorf("editTOML() error = %v, want errTOMLEdit", err)
+	}
+}
+
+func TestUpdateConfigWithoutUser(t *testing.T) {
+	// 配置文件中没有 [user] 时，保存其他修改不应写出用户配置
+	doc := "uiPort = 8080\n\n[[apps]]\nname = \"a\"\nexecute = \"a\"\n"
+	cfg, err := decodeConfig("anyrun.toml", []byte(doc), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.User != nil {
+		t.Fatalf("decodeConfig() User = %+v, want nil", cfg.User)
+	}
+	cfg.UIPort = 8081
+	want := "uiPort = 8081\n\n[[apps]]\nname = \"a\"\nexecute = \"a\"\n"
+	if got := updateConfigDocument("anyrun.toml", []byte(doc), cfg); string(got) != want {
+		t.Errorf("updateConfigDocument() =\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		line, col int
+		msg       string
+	}{
+		{"missing value", "a = ", 1, 5, "expected value, found end of file"},
+		{"duplicate key", "a = 1\na = 2", 2, 1, "duplicate key 'a'"},
+		{"duplicate table", "[t]\nx = 1\n[t]", 3, 1, "table 't' is already defined"},
+		{"inline table extended", "a = {b = 1}\n[a]\nc = 1", 2, 1, "table 'a' is already defined"},
+		{"dotted key table redefined", "a.b = 1\n[a]\n", 2, 1, "table 'a' is already defined"},
+		{"unterminated string", `a = "abc`, 1, 5, "unterminated string"},
+		{"newline in literal string", "s = 'x\ny'", 1, 5, "unterminated literal string"},
+		{"unterminated array", "x = [1,\n", 1, 5, "unterminated array"},
+		{"trailing garbage", "a = 1 b", 1, 7, "expected end of line, found 'b'"},
+		{"missing key", "= 1", 1, 1, "invalid character '=' in key"},
+		{"leading zero", "x = 01", 1, 5, "leading zeros are not allowed"},
+		{"trailing underscore", "x = 1_", 1, 5, "underscores must be between digits"},
+		{"error after multibyte text", "# 注释\nname = \"应用\"\nport = ", 3, 8, "expected value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTOML([]byte(tt.input))
+			var tomlErr *TOMLError
+			if !errors.As(err, &tomlErr) {
+				t.Fatalf("parseTOML(%q) error = %v, want *TOMLError", tt.input, err)
+			}
+			if tomlErr.Line != tt.line || tomlErr.Col != tt.col || !strings.Contains(tomlErr.Msg, tt.msg) {
+				t.Errorf("parseTOML(%q) error = %v, want line %d, column %d: %s", tt.input, err, tt.line, tt.col, tt.msg)
+			}
+		})
+	}
+}
+
+func TestParseTOMLValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  interface{}
+	}{
+		{"basic string escapes", `v = "a\tb\u00e9\"c"`, "a\tbé\"c"},
+		{"literal string", `v = 'C:\tools\app.exe'`, `C:\tools\app.exe`},
+		{"multiline basic string trims first newline", "v = \"\"\"\nline1\nline2\"\"\"", "line1\nline2"},
+		{"line ending backslash", "v = \"\"\"\na \\\n   b\"\"\"", "a b"},
+		{"multiline literal string", "v = '''\nraw \\n'''", `raw \n`},
+		{"integer with underscores", "v = 1_000", int64(1000)},
+		{"hex integer", "v = 0xff", int64(255)},
+		{"negative integer", "v = -17", int64(-17)},
+		{"float", "v = 6.5e-1", 0.65},
+		{"bool", "v = true", true},
+		{"datetime", "v = 1979-05-27T07:32:00Z", tomlDatetime("1979-05-27T07:32:00Z")},
+		{"array across lines with comments", "v = [\n  1, # one\n  2,\n]", []interface{}{int64(1), int64(2)}},
+		{"inline table", `v = { a = 1, b.c = "x" }`, map[string]interface{}{"a": int64(1), "b": map[string]interface{}{"c": "x"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseTOML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("parseTOML(%q): %v", tt.input, err)
+			}
+			if got := plainTOMLValue(doc.values["v"]); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTOML(%q) = %#v, want %#v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLTables(t *testing.T) {
+	input := `
+top = 1
+a.b = 2
+
+[server]
+host = "localhost"
+
+[server.tls]
+enabled = true
+
+[[apps]]
+name = "web"
+
+[apps.env]
+MODE = "prod"
+
+[[apps]]
+name = "worker"
+`
+	want := map[string]interface{}{
+		"top": int64(1),
+		"a":   map[string]interface{}{"b": int64(2)},
+		"server": map[string]interface{}{
+			"host": "localhost",
+			"tls":  map[string]interface{}{"enabled": true},
+		},
+		"apps": []interface{}{
+			map[string]interface{}{"name": "web", "env": map[string]interface{}{"MODE": "prod"}},
+			map[string]interface{}{"name": "worker"},
+		},
+	}
+	doc, err := parseTOML([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := plainTOMLValue(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTOML() = %#v, want %#v", got, want)
+	}
+	if want := []string{"top", "a", "server", "apps"}; !reflect.DeepEqual(doc.keys, want) {
+		t.Errorf("key order = %v, want %v", doc.keys, want)
+	}
+}
+
+// plainTOMLValue 把解析结果转换为 map 和 slice，便于与期望值比较（忽略位置信息）
+func plainTOMLValue(val interface{}) interface{} {
+	switch x := val.(type) {
+	case *tomlTable:
+		m := map[string]interface{}{}
+		for _, key := range x.keys {
+			m[key] = plainTOMLValue(x.values[key])
+		}
+		return m
+	case *tomlArrayOfTables:
+		arr := make([]interface{}, len(x.tables))
+		for i, t := range x.tables {
+			arr[i] = plainTOMLValue(t)
+		}
+		return arr
+	case []interface{}:
+		arr := make([]interface{}, len(x))
+		for i, item := range x {
+			arr[i] = plainTOMLValue(item)
+		}
+		return arr
+	}
+	return val
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ValidationError 是一条配置校验错误
+type ValidationError struct {
+	Path    string `json:"path"`           // 字段路径，例如 apps[1].port
+	Message string `json:"message"`        // 错误说明
+	Line    int    `json:"line,omitempty"` // 所在行号，配置不是从文件读取时为 0
+	File    string `json:"file,omitempty"` // 所在的 include 文件，位于主配置文件时为空
+}
+
+func (e ValidationError) Error() string {
+	msg := fmt.Sprintf("%s: %s", e.Path, e.Message)
+	if e.Line > 0 {
+		msg = fmt.Sprintf("line %d: %s", e.Line, msg)
+	}
+	if e.File != "" {
+		msg = e.File + " " + msg
+	}
+	return msg
+}
+
+// ValidationErrors 是校验得到的全部错误
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// appTypes 是 appType 允许的取值（不区分大小写），为空时按 other 处理
+var appTypes = map[string]bool{
+	"java": true, "python": true, "node": true, "node.js": true, "npm": true, "go": true, "other": true,
+}
+
+// Validate 检查配置中的语义错误，没有错误时返回 nil
+func (c Config) Validate() ValidationErrors {
+	var errs ValidationErrors
+	add := func(path, format string, args ...interface{}) {
+		errs = append(errs, ValidationError{Path: path, Message: fmt.Sprintf(format, args...), Line: c.line(path), File: c.file(path)})
+	}
+
+	if c.UIPort < 1 || c.UIPort > 65535 {
+		add("uiPort", "port %d is out of range 1-65535", c.UIPort)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Templates)) {
+		tmpl := c.Templates[name]
+		p := "templates." + name
+		if tmpl.Template != "" {
+			add(p+".template", "a template cannot use another template")
+		}
+		if tmpl.Name != "" {
+			add(p+".name", "name cannot be set in a template")
+		}
+	}
+
+	unknownDeps := false
+	names := map[string]int{}
+	ports := map[int]int{}
+	for i, app := range c.Apps {
+		p := fmt.Sprintf("apps[%d]", i)
+		if j, ok := names[app.Name]; ok {
+			add(p+".name", "duplicate app name '%s' (also used by apps[%d])", app.Name, j)
+		} else {
+			names[app.Name] = i
+		}
+		if _, ok := c.Templates[app.Template]; app.Template != "" && !ok {
+			add(p+".template", "unknown template '%s'", app.Template)
+		}
+		if strings.TrimSpace(app.Execute) == "" && strings.TrimSpace(app.AppPath) == "" {
+			add(p+".execute", "execute or appPath is required")
+		}
+		appType := strings.ToLower(app.AppType)
+		if app.AppType != "" && !appTypes[appType] {
+			add(p+".appType", "unknown appType '%s' (expected java, python, node, npm, go or other)", app.AppType)
+		}
+		if strings.TrimSpace(app.AppPath) == "" && (appType == "java" || appType == "python" || appType == "node" || appType == "node.js") {
+			add(p+".appPath", "appPath is required for appType '%s'", app.AppType)
+		}
+
+		switch app.Restart {
+		case "", RestartAlways, RestartOnFailure, RestartNever:
+		default:
+			add(p+".restart", "unknown restart policy '%s' (expected always, on-failure or never)", app.Restart)
+		}
+		switch app.KillMode {
+		case "", KillModeProcess, KillModeGroup, KillModeCgroup:
+		default:
+			add(p+".killMode", "unknown killMode '%s' (expected group, process or cgroup)", app.KillMode)
+		}
+		if _, err := stopSignal(app); err != nil {
+			add(p+".stopSignal", "unknown stopSignal '%s' (expected SIGTERM, SIGINT, SIGQUIT or SIGHUP)", app.StopSignal)
+		}
+		if hc := app.Healthcheck; hc != nil {
+			switch hc.Type {
+			case "http", "tcp", "exec":
+			default:
+				add(p+".healthcheck.type", "unknown healthcheck type '%s' (expected http, tcp or exec)", hc.Type)
+			}
+		}
+
+		if app.Port < 0 || app.Port > 65535 {
+			add(p+".port", "port %d is out of range 0-65535", app.Port)
+		} else if app.Port != 0 {
+			if app.Port == c.UIPort {
+				add(p+".port", "port %d is already used by uiPort", app.Port)
+			}
+			if j, ok := ports[app.Port]; ok {
+				add(p+".port", "port %d is already used by app '%s'", app.Port, c.Apps[j].Name)
+			} else {
+				ports[app.Port] = i
+			}
+		}
+
+		durations := []struct {
+			name  string
+			value int
+		}{
+			{"timeout", app.Timeout},
+			{"startTimeout", app.StartTimeout},
+			{"stopTimeout", app.StopTimeout},
+			{"maxRetries", app.MaxRetries},
+			{"backoffInitial", app.BackoffInitial},
+			{"backoffMax", app.BackoffMax},
+			{"resetWindow", app.ResetWindow},
+		}
+		if hc := app.Healthcheck; hc != nil {
+			durations = append(durations, []struct {
+				name  string
+				value int
+			}{
+				{"healthcheck.interval", hc.Interval},
+				{"healthcheck.timeout", hc.Timeout},
+				{"healthcheck.failureThreshold", hc.FailureThreshold},
+				{"healthcheck.successThreshold", hc.SuccessThreshold},
+			}...)
+		}
+		for _, d := range durations {
+			if d.value < 0 {
+				add(p+"."+d.name, "%s must not be negative", d.name)
+			}
+		}
+
+		// ${...} 引用在启动时展开，这里检查能否展开
+		for _, f := range interpolatedFields(&app) {
+			if _, err := interpolate(f.value); err != nil {
+				add(p+"."+f.path, "%v", err)
+			}
+		}
+
+		for _, dep := range app.DependsOn {
+			if _, ok := c.findApp(dep); !ok {
+				add(p+".dependsOn", "unknown app '%s'", dep)
+				unknownDeps = true
+			}
+		}
+	}
+
+	// 依赖都存在时再检查循环依赖
+	if !unknownDeps {
+		if err := checkDependencies(c.Apps); err != nil {
+			add("apps", "%v", err)
+		}
+	}
+	return errs
+}
+
+// findApp 按名称查找应用的下标
+func (c Config) findApp(name string) (int, bool) {
+	for i, app := range c.Apps {
+		if app.Name == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// file 返回字段所在的 include 文件，字段位于主配置文件时为空
+func (c Config) file(path string) string {
+	if i := strings.Index(path, "]"); strings.HasPrefix(path, "apps[") && i > 0 {
+		return c.files[path[:i+1]]
+	}
+	return ""
+}
+
+// line 返回字段所在的行号，字段没有出现在配置文件中时使用所在表的行号
+func (c Config) line(path string) int {
+	for path != "" {
+		if line, ok := c.lines[path]; ok {
+			return line
+		}
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return 0
+}
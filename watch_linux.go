@@ -0,0 +1,86 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// watchConfigFiles 通过 inotify 监视配置文件所在的目录，匹配 patterns 的文件被写入、替换、创建或删除时调用 changed。
+// patterns 的第一个为主配置文件；inotify 不可用时退回到轮询。
+func watchConfigFiles(patterns func() []string, changed func()) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		fmt.Printf("inotify 不可用，改为轮询配置文件: %v\n", err)
+		pollConfigFiles(patterns, changed)
+		return
+	}
+	// 监视目录而不是文件本身，编辑器保存时常常先写临时文件再重命名
+	mask := uint32(syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM)
+	dirs := map[int32]string{}
+	watch := func(current []string) error {
+		for i, pattern := range current {
+			dir := filepath.Dir(pattern)
+			wd, err := syscall.InotifyAddWatch(fd, dir, mask)
+			if err != nil {
+				// include 的目录可能还不存在，只有主配置文件所在的目录必须能够监视
+				if i == 0 {
+					return err
+				}
+				continue
+			}
+			dirs[int32(wd)] = dir
+		}
+		return nil
+	}
+	current := patterns()
+	if err := watch(current); err != nil {
+		syscall.Close(fd)
+		fmt.Printf("inotify 不可用，改为轮询配置文件: %v\n", err)
+		pollConfigFiles(patterns, changed)
+		return
+	}
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || n <= 0 {
+			syscall.Close(fd)
+			fmt.Printf("读取 inotify 事件失败，改为轮询配置文件: %v\n", err)
+			pollConfigFiles(patterns, changed)
+			return
+		}
+		// 事件结构：wd int32, mask uint32, cookie uint32, len uint32, name [len]byte
+		matched := false
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[off:]))
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			start := off + syscall.SizeofInotifyEvent
+			if start+nameLen > n {
+				break
+			}
+			if dir, ok := dirs[wd]; ok {
+				name := filepath.Join(dir, strings.TrimRight(string(buf[start:start+nameLen]), "\x00"))
+				for _, pattern := range current {
+					if ok, _ := filepath.Match(pattern, name); ok {
+						matched = true
+					}
+				}
+			}
+			off = start + nameLen
+		}
+		if matched {
+			changed()
+			// 配置中的 include 可能已经变化，监视新出现的目录
+			current = patterns()
+			watch(current)
+		}
+	}
+}
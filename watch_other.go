@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// watchConfigFiles 在非 Linux 平台上轮询配置文件
+func watchConfigFiles(patterns func() []string, changed func()) {
+	pollConfigFiles(patterns, changed)
+}
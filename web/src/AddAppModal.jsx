@@ -19,6 +19,8 @@ export default function AddAppModal({ visible, onClose, onAdded, language }) {
       // 获取当前配置
       const res = await fetch('/api/config');
       const configData = await res.json();
+      // 保存时带回配置版本，避免覆盖其他人的修改
+      const etag = res.headers.get('ETag');
       
       // 创建新的应用对象
       const newApp = {
@@ -49,10 +51,13 @@ export default function AddAppModal({ visible, onClose, onAdded, language }) {
       // 保存配置
       const saveRes = await fetch('/api/config/save', {
         method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
+        headers: { 'Content-Type': 'application/json', 'If-Match': etag || '' },
         body: JSON.stringify(updatedConfig)
       });
       
+      if (saveRes.status === 412) {
+        throw new Error(language === 'zh' ? '配置已被其他人修改，请重试' : 'Config was modified by someone else, please retry');
+      }
       if (!saveRes.ok) {
         throw new Error('Failed to save config');
       }
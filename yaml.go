@@ -0,0 +1,695 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 配置文件使用的 YAML 子集：块格式的映射和序列、单行的流格式（[a, b] 和 {a: 1}）、
+// 普通/单引号/双引号标量、| 和 > 块标量以及注释。不支持锚点、别名、标签和多文档。
+// 普通标量按 YAML 1.2 core schema 解析：null/~、true/false、整数和浮点数，其余为字符串。
+
+// yamlLine 是 YAML 文本中的一行
+type yamlLine struct {
+	off    int    // 行首在源文件中的偏移
+	indent int    // 内容之前的空格数
+	text   string // 去掉缩进和注释后的内容
+	raw    string // 整行内容（不含换行）
+}
+
+type yamlParser struct {
+	data  []byte
+	lines []yamlLine
+	i     int
+}
+
+var (
+	yamlIntPattern   = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	yamlFloatPattern = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+// parseYAMLDocument 解析 YAML 格式的配置，顶层必须是映射。值为 null 的键视为没有设置。
+func parseYAMLDocument(data []byte) (*tomlTable, error) {
+	if !utf8.Valid(data) {
+		return nil, &TOMLError{Line: 1, Col: 1, Msg: "file is not valid UTF-8"}
+	}
+	p := &yamlParser{data: data}
+	started := false
+	for off := 0; off < len(data); {
+		end := bytes.IndexByte(data[off:], '\n')
+		next := off + end + 1
+		if end < 0 {
+			end = len(data) - off
+			next = len(data)
+		}
+		raw := strings.TrimSuffix(string(data[off:off+end]), "\r")
+		line := yamlLine{off: off, raw: raw}
+		for line.indent < len(raw) && raw[line.indent] == ' ' {
+			line.indent++
+		}
+		line.text = strings.TrimRight(stripYAMLComment(raw[line.indent:]), " \t")
+		if line.text != "" && raw[line.indent] == '\t' {
+			return nil, p.errorf(off+line.indent, "tabs are not allowed for indentation")
+		}
+		switch {
+		case line.indent == 0 && (line.text == "---" || strings.HasPrefix(line.text, "--- ")):
+			if started {
+				return nil, p.errorf(off, "multiple YAML documents are not supported")
+			}
+			if rest := strings.TrimSpace(line.text[3:]); rest != "" {
+				return nil, p.errorf(off+4, "expected a mapping at the top level")
+			}
+			line.text = ""
+		case line.indent == 0 && line.text == "...":
+			next = len(data)
+			line.text = ""
+		case line.indent == 0 && strings.HasPrefix(line.text, "%") && !started:
+			// %YAML 等指令
+			line.text = ""
+		}
+		if line.text != "" {
+			started = true
+		}
+		p.lines = append(p.lines, line)
+		off = next
+	}
+
+	if !p.skipBlank() {
+		return newTOMLTable(), nil
+	}
+	first := p.lines[p.i]
+	if isYAMLSeqItem(first.text) || !hasYAMLKey(first.text) {
+		return nil, p.errorf(first.off+first.indent, "expected a mapping at the top level")
+	}
+	val, err := p.block(first.indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipBlank() {
+		line := p.lines[p.i]
+		return nil, p.errorf(line.off+line.indent, "unexpected indentation")
+	}
+	return val.(*tomlTable), nil
+}
+
+// stripYAMLComment 去掉行尾注释：# 位于行首或空白之后，且不在引号内
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"':
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				quote = 0
+			}
+		case quote == '\'':
+			if c == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					i++
+				} else {
+					quote = 0
+				}
+			}
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t[{,:-", s[i-1]) >= 0):
+			quote = c
+		}
+	}
+	return s
+}
+
+// yamlHasComments 判断 YAML 文本中是否有注释（多行字符串中以 # 开头的内容也会被当作注释）
+func yamlHasComments(data []byte) bool {
+	for _, line := range strings.Split(string(data), "\n") {
+		if stripYAMLComment(line) != line {
+			return true
+		}
+	}
+	return false
+}
+
+// skipBlank 跳过空行和注释行，返回是否还有内容
+func (p *yamlParser) skipBlank() bool {
+	for p.i < len(p.lines) && p.lines[p.i].text == "" {
+		p.i++
+	}
+	return p.i < len(p.lines)
+}
+
+func (p *yamlParser) errorf(off int, format string, args ...interface{}) error {
+	d := &tomlDecoder{data: p.data}
+	return d.errorf(off, format, args...)
+}
+
+// isYAMLSeqItem 判断一行是否为序列的元素（- value）
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// hasYAMLKey 判断一行是否为映射的键值对（key: value）
+func hasYAMLKey(text string) bool {
+	_, _, ok := splitYAMLKey(text)
+	return ok
+}
+
+// splitYAMLKey 把 key: value 拆分为键和值，valueCol 是值在 text 中的起始位置
+func splitYAMLKey(text string) (key string, valueCol int, ok bool) {
+	if text == "" || strings.IndexByte("[{", text[0]) >= 0 {
+		return "", 0, false
+	}
+	end := 0
+	if text[0] == '"' || text[0] == '\'' {
+		var err error
+		key, end, err = parseYAMLQuoted(text)
+		if err != nil {
+			return "", 0, false
+		}
+		rest := strings.TrimLeft(text[end:], " ")
+		if !strings.HasPrefix(rest, ":") || len(rest) > 1 && rest[1] != ' ' {
+			return "", 0, false
+		}
+		end = len(text) - len(rest)
+	} else {
+		end = strings.Index(text, ": ")
+		if end < 0 {
+			if !strings.HasSuffix(text, ":") {
+				return "", 0, false
+			}
+			end = len(text) - 1
+		}
+		key = strings.TrimRight(text[:end], " ")
+		if key == "" {
+			return "", 0, false
+		}
+	}
+	valueCol = end + 1
+	for valueCol < len(text) && text[valueCol] == ' ' {
+		valueCol++
+	}
+	return key, valueCol, true
+}
+
+// block 解析从当前行开始、缩进为 indent 的块：映射、序列或单个标量
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	line := p.lines[p.i]
+	if isYAMLSeqItem(line.text) {
+		return p.sequence(indent)
+	}
+	if hasYAMLKey(line.text) {
+		return p.mapping(indent)
+	}
+	p.i++
+	return p.scalar(line.text, line.off+line.indent)
+}
+
+// mapping 解析缩进为 indent 的映射
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	t := newTOMLTable()
+	t.start = p.lines[p.i].off + indent
+	for p.skipBlank() {
+		line := p.lines[p.i]
+		if line.indent < indent {
+			break
+		}
+		lineOff := line.off + line.indent
+		if line.indent > indent {
+			return nil, p.errorf(lineOff, "unexpected indentation")
+		}
+		key, valueCol, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, p.errorf(lineOff, "expected 'key: value', found '%s'", line.text)
+		}
+		if _, dup := t.values[key]; dup {
+			return nil, p.errorf(lineOff, "duplicate key '%s'", key)
+		}
+		p.i++
+		rest := line.text[valueCol:]
+		valOff := lineOff + valueCol
+		var val interface{}
+		var err error
+		switch {
+		case rest == "":
+			// 值在下面缩进更多的行中；序列的 - 可以与键对齐
+			if p.skipBlank() {
+				next := p.lines[p.i]
+				if next.indent > indent || next.indent == indent && isYAMLSeqItem(next.text) {
+					valOff = next.off + next.indent
+					val, err = p.block(next.indent)
+				}
+			}
+		case rest[0] == '|' || rest[0] == '>':
+			val, err = p.blockScalar(rest, indent, valOff)
+		default:
+			val, err = p.scalar(rest, valOff)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if val == nil {
+			continue
+		}
+		t.set(key, val, valOff)
+		t.keyPos[key] = lineOff
+		t.end[key] = line.off + len(line.raw)
+	}
+	return t, nil
+}
+
+// sequence 解析缩进为 indent 的序列
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	var arr []interface{}
+	for p.skipBlank() {
+		line := p.lines[p.i]
+		if line.indent < indent {
+			break
+		}
+		lineOff := line.off + line.indent
+		if line.indent > indent {
+			return nil, p.errorf(lineOff, "unexpected indentation")
+		}
+		if !isYAMLSeqItem(line.text) {
+			// 与键对齐的序列之后是上一级映射的下一个键
+			break
+		}
+		rest := strings.TrimLeft(line.text[1:], " ")
+		col := line.indent + len(line.text) - len(rest)
+		var item interface{}
+		var err error
+		switch {
+		case rest == "":
+			p.i++
+			if p.skipBlank() && p.lines[p.i].indent > indent {
+				item, err = p.block(p.lines[p.i].indent)
+			}
+		case isYAMLSeqItem(rest) || hasYAMLKey(rest):
+			// "- key: value" 的剩余部分相当于缩进为 col 的一行，之后的键与它对齐
+			p.lines[p.i] = yamlLine{off: line.off, indent: col, text: rest, raw: line.raw}
+			item, err = p.block(col)
+		case rest[0] == '|' || rest[0] == '>':
+			p.i++
+			item, err = p.blockScalar(rest, indent, line.off+col)
+		default:
+			p.i++
+			item, err = p.scalar(rest, line.off+col)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if item == nil {
+			return nil, p.errorf(lineOff, "null is not allowed in sequences")
+		}
+		arr = append(arr, item)
+	}
+	return tableArray(arr), nil
+}
+
+// blockScalar 解析 | 或 > 开头的块标量，内容为之后缩进大于 parent 的行
+func (p *yamlParser) blockScalar(header string, parent, off int) (interface{}, error) {
+	chomp := header[1:]
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return nil, p.errorf(off, "unsupported block scalar header '%s'", header)
+	}
+	var lines []string
+	indent := -1
+	for ; p.i < len(p.lines); p.i++ {
+		raw := p.lines[p.i].raw
+		if strings.TrimSpace(raw) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		n := len(raw) - len(strings.TrimLeft(raw, " "))
+		if n <= parent {
+			break
+		}
+		if indent < 0 {
+			indent = n
+		}
+		if n < indent {
+			return nil, p.errorf(p.lines[p.i].off, "block scalar lines must be indented at least %d spaces", indent)
+		}
+		lines = append(lines, raw[indent:])
+	}
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+	// 块标量之后的空行不属于文档结构
+	p.i -= trailing
+
+	var body string
+	if header[0] == '|' {
+		body = strings.Join(lines, "\n")
+	} else {
+		var b strings.Builder
+		for i, l := range lines {
+			switch {
+			case i == 0:
+			case l == "" || lines[i-1] == "":
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(' ')
+			}
+			b.WriteString(l)
+		}
+		body = b.String()
+	}
+	switch {
+	case chomp == "-" || body == "":
+	case chomp == "+":
+		body += strings.Repeat("\n", trailing+1)
+	default:
+		body += "\n"
+	}
+	return body, nil
+}
+
+// scalar 解析单行的值：流格式的序列或映射、带引号的字符串或普通标量
+func (p *yamlParser) scalar(s string, off int) (interface{}, error) {
+	val, end, err := p.flowValue(s, 0, off, false)
+	if err != nil {
+		return nil, err
+	}
+	if rest := strings.TrimSpace(s[end:]); rest != "" {
+		return nil, p.errorf(off+end, "unexpected '%s' after value", rest)
+	}
+	return val, nil
+}
+
+// flowValue 解析 s[i:] 开头的一个值，inFlow 表示位于 [] 或 {} 内，此时普通标量在 , ] } 处结束
+func (p *yamlParser) flowValue(s string, i, off int, inFlow bool) (interface{}, int, error) {
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	if i == len(s) {
+		return nil, i, nil
+	}
+	switch s[i] {
+	case '[':
+		var arr []interface{}
+		i++
+		for {
+			for i < len(s) && s[i] == ' ' {
+				i++
+			}
+			if i < len(s) && s[i] == ']' {
+				return tableArray(arr), i + 1, nil
+			}
+			item, end, err := p.flowValue(s, i, off, true)
+			if err != nil {
+				return nil, end, err
+			}
+			if item == nil {
+				return nil, end, p.errorf(off+i, "null is not allowed in sequences")
+			}
+			arr = append(arr, item)
+			if i, err = p.flowSeparator(s, end, off, ']'); err != nil {
+				return nil, i, err
+			}
+			if s[i-1] == ']' {
+				return tableArray(arr), i, nil
+			}
+		}
+	case '{':
+		t := newTOMLTable()
+		t.start = off + i
+		i++
+		for {
+			for i < len(s) && s[i] == ' ' {
+				i++
+			}
+			if i < len(s) && s[i] == '}' {
+				return t, i + 1, nil
+			}
+			keyOff := i
+			var key string
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				k, n, err := parseYAMLQuoted(s[i:])
+				if err != nil {
+					return nil, i, p.errorf(off+i, "%v", err)
+				}
+				key, i = k, i+n
+				for i < len(s) && s[i] == ' ' {
+					i++
+				}
+			} else {
+				end := strings.IndexAny(s[i:], ":,}")
+				if end < 0 {
+					end = len(s) - i
+				}
+				key = strings.TrimSpace(s[i : i+end])
+				i += end
+			}
+			if key == "" || i >= len(s) || s[i] != ':' {
+				return nil, i, p.errorf(off+keyOff, "expected 'key: value' in flow mapping")
+			}
+			if _, dup := t.values[key]; dup {
+				return nil, i, p.errorf(off+keyOff, "duplicate key '%s'", key)
+			}
+			val, end, err := p.flowValue(s, i+1, off, true)
+			if err != nil {
+				return nil, end, err
+			}
+			if val != nil {
+				t.set(key, val, off+i+1)
+				t.keyPos[key] = off + keyOff
+				t.end[key] = off + end
+			}
+			if i, err = p.flowSeparator(s, end, off, '}'); err != nil {
+				return nil, i, err
+			}
+			if s[i-1] == '}' {
+				return t, i, nil
+			}
+		}
+	case '"', '\'':
+		val, n, err := parseYAMLQuoted(s[i:])
+		if err != nil {
+			return nil, i, p.errorf(off+i, "%v", err)
+		}
+		return val, i + n, nil
+	case '&', '*', '!':
+		return nil, i, p.errorf(off+i, "YAML anchors, aliases and tags are not supported")
+	}
+	end := len(s)
+	if inFlow {
+		if n := strings.IndexAny(s[i:], ",]}"); n >= 0 {
+			end = i + n
+		}
+	}
+	return resolveYAMLPlain(strings.TrimSpace(s[i:end])), end, nil
+}
+
+// flowSeparator 跳过流格式中值之后的 , 或结束符 closing，返回之后的位置
+func (p *yamlParser) flowSeparator(s string, i, off int, closing byte) (int, error) {
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	if i < len(s) && (s[i] == ',' || s[i] == closing) {
+		return i + 1, nil
+	}
+	return i, p.errorf(off+i, "expected ',' or '%c'", closing)
+}
+
+// parseYAMLQuoted 解析 s 开头的单引号或双引号字符串，返回其值和结束位置
+func parseYAMLQuoted(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote && quote == '\'':
+			if i+1 < len(s) && s[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			return b.String(), i + 1, nil
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && quote == '"':
+			if i+1 >= len(s) {
+				break
+			}
+			i++
+			switch e := s[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't', '\t':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '0':
+				b.WriteByte(0)
+			case 'a':
+				b.WriteByte('\a')
+			case 'b':
+				b.WriteByte('\b')
+			case 'e':
+				b.WriteByte(0x1b)
+			case 'f':
+				b.WriteByte('\f')
+			case 'v':
+				b.WriteByte('\v')
+			case '"', '\\', '/', ' ':
+				b.WriteByte(e)
+			case 'x', 'u', 'U':
+				n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+				if i+n >= len(s) {
+					return "", i, fmt.Errorf("invalid escape '\\%c' in string", e)
+				}
+				r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+				if err != nil {
+					return "", i, fmt.Errorf("invalid escape '\\%s' in string", s[i:i+1+n])
+				}
+				b.WriteRune(rune(r))
+				i += n
+			default:
+				return "", i, fmt.Errorf("invalid escape '\\%c' in string", e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", len(s), fmt.Errorf("unterminated string (multi-line strings must use | or >)")
+}
+
+// resolveYAMLPlain 按 YAML 1.2 core schema 解析普通标量
+func resolveYAMLPlain(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF":
+		return math.Inf(1)
+	case "-.inf", "-.Inf", "-.INF":
+		return math.Inf(-1)
+	case ".nan", ".NaN", ".NAN":
+		return math.NaN()
+	}
+	if yamlIntPattern.MatchString(s) {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+	}
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0o") {
+		base := map[byte]int{'x': 16, 'o': 8}[s[1]]
+		if i, err := strconv.ParseInt(s[2:], base, 64); err == nil {
+			return i
+		}
+	}
+	if yamlFloatPattern.MatchString(s) {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
+
+// writeYAMLTable 把表写成块格式的 YAML，indent 为缩进的空格数
+func writeYAMLTable(b *bytes.Buffer, t *tomlTable, indent int) {
+	for _, key := range t.keys {
+		b.WriteString(strings.Repeat(" ", indent) + yamlString(key) + ":")
+		writeYAMLValue(b, t.values[key], indent)
+	}
+}
+
+// writeYAMLValue 写出 "key:" 或 "-" 之后的值：子表和序列写在下面缩进两个空格的行中
+func writeYAMLValue(b *bytes.Buffer, val interface{}, indent int) {
+	switch x := val.(type) {
+	case *tomlTable:
+		if len(x.keys) == 0 {
+			b.WriteString(" {}\n")
+			return
+		}
+		b.WriteByte('\n')
+		writeYAMLTable(b, x, indent+2)
+	case *tomlArrayOfTables:
+		items := make([]interface{}, len(x.tables))
+		for i, t := range x.tables {
+			items[i] = t
+		}
+		writeYAMLValue(b, items, indent)
+	case []interface{}:
+		if len(x) == 0 {
+			b.WriteString(" []\n")
+			return
+		}
+		b.WriteByte('\n')
+		pad := strings.Repeat(" ", indent+2)
+		for _, item := range x {
+			if t, ok := item.(*tomlTable); ok && len(t.keys) > 0 {
+				// 表的第一个键写在 - 之后，其余的键与之对齐
+				var sub bytes.Buffer
+				writeYAMLTable(&sub, t, indent+4)
+				b.WriteString(pad + "- ")
+				b.Write(sub.Bytes()[indent+4:])
+				continue
+			}
+			b.WriteString(pad + "-")
+			writeYAMLValue(b, item, indent+2)
+		}
+	default:
+		b.WriteString(" " + yamlScalar(x) + "\n")
+	}
+}
+
+// yamlScalar 把标量写成 YAML 文本
+func yamlScalar(val interface{}) string {
+	switch x := val.(type) {
+	case string:
+		return yamlString(x)
+	case tomlDatetime:
+		return yamlString(string(x))
+	case float64:
+		switch {
+		case math.IsInf(x, 1):
+			return ".inf"
+		case math.IsInf(x, -1):
+			return "-.inf"
+		case math.IsNaN(x):
+			return ".nan"
+		}
+		s := strconv.FormatFloat(x, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEn") {
+			s += ".0"
+		}
+		return s
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// yamlString 写出字符串：能作为普通标量读回同样的字符串时不加引号，否则使用双引号
+func yamlString(s string) string {
+	plain := s != "" && s == strings.TrimSpace(s) &&
+		strings.IndexByte("-?:,[]{}#&*!|>'\"%@`", s[0]) < 0 &&
+		!strings.Contains(s, ": ") && !strings.Contains(s, " #") && !strings.HasSuffix(s, ":")
+	if plain {
+		if _, ok := resolveYAMLPlain(s).(string); !ok {
+			plain = false
+		}
+	}
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			plain = false
+		}
+	}
+	if plain {
+		return s
+	}
+	var b bytes.Buffer
+	writeJSONScalar(&b, s)
+	return b.String()
+}